@@ -0,0 +1,16 @@
+package api
+
+import "net/http"
+
+// AccountHandler serves a request with the handler of the account named by
+// the {name} path value, and answers 404 for an unknown account
+func AccountHandler(handlers map[string]http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h, ok := handlers[r.PathValue("name")]
+		if !ok {
+			writeError(w, http.StatusNotFound, "unknown account")
+			return
+		}
+		h.ServeHTTP(w, r)
+	}
+}
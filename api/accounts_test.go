@@ -0,0 +1,28 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAccountHandlerDispatchesByName(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/accounts/{name}/media", AccountHandler(map[string]http.Handler{
+		"clinic": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("clinic"))
+		}),
+	}))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/accounts/clinic/media", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "clinic" {
+		t.Fatalf("expected the clinic handler, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/accounts/kids/media", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown account, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"backend-service/internal/bootstrap"
+	"backend-service/internal/logging"
+	"backend-service/internal/token"
+)
+
+// tokenInfo is the admin view of the current token. The token itself is
+// never returned in full.
+type tokenInfo struct {
+	AccessToken string                `json:"access_token"`
+	ExpiresAt   time.Time             `json:"expires_at"`
+	Source      string                `json:"source,omitempty"`
+	Health      bootstrap.TokenHealth `json:"health"`
+}
+
+// installRequest carries a long-lived token obtained outside the service.
+// Either expires_at or expires_in (seconds) must be set.
+type installRequest struct {
+	AccessToken string    `json:"access_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	ExpiresIn   int64     `json:"expires_in"`
+}
+
+// AdminTokenHandler serves GET (token metadata) and PUT (install a new
+// token) on /admin/token
+func AdminTokenHandler(refresher *bootstrap.Refresher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(currentTokenInfo(refresher))
+
+		case http.MethodPut:
+			var req installRequest
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid JSON body")
+				return
+			}
+
+			t := token.Token{AccessToken: req.AccessToken, ExpiresAt: req.ExpiresAt}
+			if req.ExpiresIn > 0 {
+				t.ExpiresAt = time.Now().Add(time.Duration(req.ExpiresIn) * time.Second)
+			}
+
+			if err := refresher.Install(t); err != nil {
+				writeTokenError(w, err)
+				return
+			}
+			json.NewEncoder(w).Encode(currentTokenInfo(refresher))
+
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// AdminTokenRefreshHandler forces a token refresh against Instagram
+func AdminTokenRefreshHandler(refresher *bootstrap.Refresher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		if err := refresher.ForceRefresh(); err != nil {
+			writeTokenError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(currentTokenInfo(refresher))
+	}
+}
+
+func currentTokenInfo(refresher *bootstrap.Refresher) tokenInfo {
+	t := refresher.Runtime.Token()
+	return tokenInfo{
+		AccessToken: maskToken(t.AccessToken),
+		ExpiresAt:   t.ExpiresAt,
+		Source:      refresher.Runtime.Source(),
+		Health:      refresher.Health(),
+	}
+}
+
+// writeTokenError maps refresher errors to responses. Per-source save
+// failures mean the token is in use but some stores are out of date.
+func writeTokenError(w http.ResponseWriter, err error) {
+	var srcErr *token.SourceError
+	switch {
+	case errors.Is(err, bootstrap.ErrInvalidToken):
+		writeError(w, http.StatusBadRequest, logging.Redact(err.Error()))
+	case errors.Is(err, bootstrap.ErrRefreshInProgress):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.As(err, &srcErr):
+		logger.Error("token stored with source errors", "handler", "admin", logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "token is in use but was not saved to every source: "+logging.Redact(err.Error()))
+	default:
+		logger.Error("token operation failed", "handler", "admin", logging.Err(err))
+		writeError(w, http.StatusBadGateway, logging.Redact(err.Error()))
+	}
+}
+
+// maskToken keeps only enough of the token to tell tokens apart
+func maskToken(t string) string {
+	if len(t) <= 12 {
+		return "****"
+	}
+	return t[:4] + "…" + t[len(t)-4:]
+}
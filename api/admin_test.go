@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"backend-service/internal/bootstrap"
+	"backend-service/internal/token"
+	"backend-service/middleware"
+)
+
+func TestAdminInstallTokenWritesThroughAndMasks(t *testing.T) {
+	disk := token.NewDiskSource(filepath.Join(t.TempDir(), "token.json"))
+	refresher := &bootstrap.Refresher{
+		Runtime: token.NewRuntime(),
+		Chain:   token.Chain{disk},
+	}
+	handler := middleware.AdminAuth("admin-key", AdminTokenHandler(refresher))
+
+	body := `{"access_token":"IGAAlongLivedToken1234","expires_in":5184000}`
+	req := httptest.NewRequest(http.MethodPut, "/admin/token", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer admin-key")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var info tokenInfo
+	if err := json.NewDecoder(rec.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.AccessToken != "IGAA…1234" || info.Source != "admin" {
+		t.Fatalf("unexpected token info: %+v", info)
+	}
+
+	saved, err := disk.Load()
+	if err != nil || saved.AccessToken != "IGAAlongLivedToken1234" {
+		t.Fatalf("expected token written to disk, got %v, %v", saved, err)
+	}
+}
+
+func TestAdminEndpointsRequireAPIKey(t *testing.T) {
+	refresher := &bootstrap.Refresher{Runtime: token.NewRuntime()}
+	handler := middleware.AdminAuth("admin-key", AdminTokenHandler(refresher))
+
+	for _, auth := range []string{"", "Bearer wrong-key", "admin-key"} {
+		req := httptest.NewRequest(http.MethodGet, "/admin/token", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401 for Authorization %q, got %d", auth, rec.Code)
+		}
+		if rec.Header().Get("Content-Type") != "application/json" || strings.TrimSpace(rec.Body.String()) != `{"error":"unauthorized"}` {
+			t.Fatalf("expected a JSON error, got %s %q", rec.Header().Get("Content-Type"), rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"backend-service/internal/archive"
+	"backend-service/internal/instagram"
+	"backend-service/internal/logging"
+)
+
+// CaptionHistorian returns every recorded caption of a media item, oldest first
+type CaptionHistorian interface {
+	GetCaptionHistory(id string) ([]archive.CaptionHistory, error)
+}
+
+// captionHistory is the response body of MediaCaptionsHandler
+type captionHistory struct {
+	ID       string                   `json:"id"`
+	Captions []archive.CaptionHistory `json:"captions"`
+}
+
+// MediaCaptionsHandler serves the caption history the archive recorded for
+// the media named by the {id} path value, including media since deleted on
+// Instagram
+func MediaCaptionsHandler(history CaptionHistorian) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		id := r.PathValue("id")
+		if !instagram.ValidMediaID(id) {
+			writeError(w, http.StatusNotFound, "media not found")
+			return
+		}
+		captions, err := history.GetCaptionHistory(id)
+		if err != nil {
+			logger.Error("failed to load caption history", "id", id, logging.Err(err))
+			writeError(w, http.StatusServiceUnavailable, "caption history unavailable")
+			return
+		}
+		if len(captions) == 0 {
+			writeError(w, http.StatusNotFound, "media not found")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(captionHistory{ID: id, Captions: captions})
+	}
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend-service/internal/archive"
+)
+
+type fakeHistory map[string][]archive.CaptionHistory
+
+func (f fakeHistory) GetCaptionHistory(id string) ([]archive.CaptionHistory, error) {
+	if id == "500" {
+		return nil, errors.New("database down")
+	}
+	return f[id], nil
+}
+
+func TestMediaCaptionsHandler(t *testing.T) {
+	edited := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	routes := http.NewServeMux()
+	routes.Handle("/media/{id}/captions", MediaCaptionsHandler(fakeHistory{
+		"1": {{Caption: "first", RecordedAt: edited.Add(-24 * time.Hour)}, {Caption: "first (edited)", RecordedAt: edited}},
+	}))
+
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/media/1/captions", nil))
+	var got captionHistory
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || got.ID != "1" || len(got.Captions) != 2 || got.Captions[1].Caption != "first (edited)" {
+		t.Fatalf("expected both caption versions, got %d %+v", rec.Code, got)
+	}
+
+	for target, want := range map[string]int{
+		"/media/2/captions":   http.StatusNotFound,
+		"/media/abc/captions": http.StatusNotFound,
+		"/media/500/captions": http.StatusServiceUnavailable,
+	} {
+		rec = httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != want {
+			t.Errorf("%s: expected %d, got %d", target, want, rec.Code)
+		}
+	}
+}
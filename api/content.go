@@ -0,0 +1,109 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"backend-service/internal/instagram"
+	"backend-service/internal/logging"
+	"backend-service/internal/mediasync"
+)
+
+// contentCacheControl lets our CDN keep assets for a day. Instagram never
+// changes the bytes behind a media ID, only the signature on its URL.
+const contentCacheControl = "public, max-age=86400"
+
+// upstreamHeaders are copied from Instagram's CDN response to ours
+var upstreamHeaders = []string{"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges", "Last-Modified"}
+
+// MediaContentHandler streams the image or video of the media named by the
+// {id} path value from Instagram's CDN under a stable URL, refreshing the
+// signed URL when it has expired. Range requests are passed through.
+func MediaContentHandler(assets *mediasync.Assets) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		id := r.PathValue("id")
+		etag := fmt.Sprintf("%q", "ig-"+id)
+		if assets.Cached(id) && notModified(w, r, etag) {
+			return
+		}
+
+		// A Range guarded by an If-Range that no longer matches our ETag is
+		// dropped so the whole asset is sent, as RFC 9110 requires
+		header := http.Header{}
+		if rng := r.Header.Get("Range"); rng != "" {
+			if ifRange := r.Header.Get("If-Range"); ifRange == "" || ifRange == etag {
+				header.Set("Range", rng)
+			}
+		}
+
+		res, err := assets.Open(r.Context(), r.Method, id, mediaURL, header)
+		if err != nil {
+			writeAssetError(w, id, err)
+			return
+		}
+		defer res.Body.Close()
+
+		switch res.StatusCode {
+		case http.StatusOK, http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable:
+		default:
+			logger.Warn("unexpected CDN response for media content", "id", id, "status", res.StatusCode)
+			writeError(w, http.StatusBadGateway, "media content unavailable")
+			return
+		}
+
+		for _, h := range upstreamHeaders {
+			if v := res.Header.Get(h); v != "" {
+				w.Header().Set(h, v)
+			}
+		}
+		if w.Header().Get("Accept-Ranges") == "" {
+			w.Header().Set("Accept-Ranges", "bytes")
+		}
+		w.Header().Set("ETag", etag)
+		if res.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+			w.Header().Set("Cache-Control", contentCacheControl)
+		}
+		w.WriteHeader(res.StatusCode)
+		if r.Method == http.MethodGet {
+			io.Copy(w, res.Body)
+		}
+	}
+}
+
+func mediaURL(m instagram.Media) string {
+	return m.MediaURL
+}
+
+// notModified answers 304 when the request already holds etag, and writes
+// nothing otherwise
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	match := r.Header.Get("If-None-Match")
+	if match == "" || (match != etag && match != "*") {
+		return false
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", contentCacheControl)
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// writeAssetError maps a failure to open a media asset to a response
+func writeAssetError(w http.ResponseWriter, id string, err error) {
+	switch {
+	case errors.Is(err, instagram.ErrMediaNotFound):
+		writeError(w, http.StatusNotFound, "media not found")
+	case errors.Is(err, mediasync.ErrNoAsset):
+		writeError(w, http.StatusNotFound, err.Error())
+	default:
+		logger.Warn("failed to fetch media content", "id", id, logging.Err(err))
+		writeError(w, http.StatusBadGateway, "media content unavailable")
+	}
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"backend-service/internal/cache"
+	"backend-service/internal/instagram"
+	"backend-service/internal/mediasync"
+	"backend-service/internal/token"
+)
+
+func TestMediaContentRefreshesExpiredURL(t *testing.T) {
+	var graphCalls atomic.Int32
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// The CDN rejects the stale signature and serves the asset with ranges
+	mux.HandleFunc("/cdn/stale.mp4", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	mux.HandleFunc("/cdn/fresh.mp4", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "fresh.mp4", time.Time{}, strings.NewReader("0123456789"))
+	})
+	mux.HandleFunc("/42", func(w http.ResponseWriter, r *http.Request) {
+		graphCalls.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{
+			"id": "42", "media_type": "VIDEO", "media_url": srv.URL + "/cdn/fresh.mp4",
+			"owner": map[string]string{"id": "test_user"},
+		})
+	})
+
+	rt := token.NewRuntime()
+	rt.Set(token.Token{AccessToken: "TEST_TOKEN"})
+	store := cache.NewStore()
+	store.SetMedia([]instagram.Media{{ID: "42", MediaType: "VIDEO", MediaURL: srv.URL + "/cdn/stale.mp4"}})
+	syncer := &mediasync.Syncer{
+		Store:   store,
+		Service: &instagram.Service{Client: srv.Client(), BaseURL: srv.URL, IgUserID: "test_user", TokenStore: rt},
+	}
+
+	routes := http.NewServeMux()
+	routes.Handle("/media/{id}/content", MediaContentHandler(&mediasync.Assets{Syncer: syncer, Client: srv.Client()}))
+
+	req := httptest.NewRequest(http.MethodGet, "/media/42/content", nil)
+	req.Header.Set("Range", "bytes=2-5")
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "2345" {
+		t.Fatalf("expected 206 with bytes 2-5, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Content-Range") != "bytes 2-5/10" {
+		t.Fatalf("expected the CDN's Content-Range, got %q", rec.Header().Get("Content-Range"))
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" || rec.Header().Get("Cache-Control") == "" {
+		t.Fatalf("expected ETag and Cache-Control, got %v", rec.Header())
+	}
+	if graphCalls.Load() != 1 {
+		t.Fatalf("expected one Graph API refetch, got %d", graphCalls.Load())
+	}
+	if got := store.GetByIDs([]string{"42"}); got[0].MediaURL != srv.URL+"/cdn/fresh.mp4" {
+		t.Fatalf("expected the cache to hold the fresh URL, got %s", got[0].MediaURL)
+	}
+
+	// A revalidation is answered without going to the CDN or Instagram
+	req = httptest.NewRequest(http.MethodGet, "/media/42/content", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", rec.Code)
+	}
+
+	// An unsatisfiable range must not be cached downstream
+	req = httptest.NewRequest(http.MethodGet, "/media/42/content", nil)
+	req.Header.Set("Range", "bytes=50-60")
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusRequestedRangeNotSatisfiable || rec.Header().Get("Cache-Control") != "" {
+		t.Fatalf("expected an uncacheable 416, got %d %q", rec.Code, rec.Header().Get("Cache-Control"))
+	}
+}
+
+func TestMediaContentRefreshesArePerID(t *testing.T) {
+	var graphCalls atomic.Int32
+	bothRefreshing := make(chan struct{})
+	var arrived atomic.Int32
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/cdn/stale/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	mux.HandleFunc("/cdn/fresh/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.PathValue("id")))
+	})
+	mux.HandleFunc("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		graphCalls.Add(1)
+		// Each refetch waits for the other ID's, so they only finish if
+		// refreshes for different IDs run at the same time
+		if arrived.Add(1) == 2 {
+			close(bothRefreshing)
+		}
+		select {
+		case <-bothRefreshing:
+		case <-time.After(2 * time.Second):
+		}
+		id := r.PathValue("id")
+		json.NewEncoder(w).Encode(map[string]any{"id": id, "media_url": srv.URL + "/cdn/fresh/" + id, "owner": map[string]string{"id": "test_user"}})
+	})
+
+	rt := token.NewRuntime()
+	rt.Set(token.Token{AccessToken: "TEST_TOKEN"})
+	store := cache.NewStore()
+	store.SetMedia([]instagram.Media{
+		{ID: "1", MediaURL: srv.URL + "/cdn/stale/1"},
+		{ID: "2", MediaURL: srv.URL + "/cdn/stale/2"},
+	})
+	syncer := &mediasync.Syncer{
+		Store:   store,
+		Service: &instagram.Service{Client: srv.Client(), BaseURL: srv.URL, IgUserID: "test_user", TokenStore: rt},
+	}
+	routes := http.NewServeMux()
+	routes.Handle("/media/{id}/content", MediaContentHandler(&mediasync.Assets{Syncer: syncer, Client: srv.Client()}))
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := range 6 {
+		id := strconv.Itoa(i%2 + 1)
+		wg.Go(func() {
+			rec := httptest.NewRecorder()
+			routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/media/"+id+"/content", nil))
+			if rec.Code != http.StatusOK || rec.Body.String() != id {
+				t.Errorf("media %s: expected 200, got %d %q", id, rec.Code, rec.Body.String())
+			}
+		})
+	}
+	wg.Wait()
+
+	if time.Since(start) >= 2*time.Second {
+		t.Fatal("expected refreshes for different IDs to run concurrently")
+	}
+	if graphCalls.Load() != 2 {
+		t.Fatalf("expected one Graph API refetch per ID, got %d", graphCalls.Load())
+	}
+}
+
+func TestMediaContentDeletedMedia(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/cdn/stale.jpg", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	})
+	mux.HandleFunc("/7", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":{"message":"Unsupported get request.","type":"GraphMethodException","code":100,"error_subcode":33}}`))
+	})
+
+	rt := token.NewRuntime()
+	rt.Set(token.Token{AccessToken: "TEST_TOKEN"})
+	store := cache.NewStore()
+	store.SetMedia([]instagram.Media{{ID: "7", MediaURL: srv.URL + "/cdn/stale.jpg"}})
+	syncer := &mediasync.Syncer{
+		Store:   store,
+		Service: &instagram.Service{Client: srv.Client(), BaseURL: srv.URL, IgUserID: "test_user", TokenStore: rt},
+	}
+
+	routes := http.NewServeMux()
+	routes.Handle("/media/{id}/content", MediaContentHandler(&mediasync.Assets{Syncer: syncer, Client: srv.Client()}))
+
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/media/7/content", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for media deleted on Instagram, got %d", rec.Code)
+	}
+	if store.Len() != 0 {
+		t.Fatal("expected the deleted media to be dropped from the cache")
+	}
+}
@@ -3,42 +3,58 @@ package api
 import (
 	"backend-service/internal/cache"
 	"backend-service/internal/instagram"
+	"backend-service/internal/logging"
+	"backend-service/internal/mediasync"
 	"encoding/json"
-	"log"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var logger = logging.Component("api")
+
+var cacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "media_cache_lookups_total",
+	Help: "Media IDs requested through /media?ids= by whether they were cached.",
+}, []string{"result"})
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
 )
 
-func MediaHandler(store *cache.Store, service *instagram.Service) http.HandlerFunc {
+// mediaPage is the response envelope for paginated /media requests
+type mediaPage struct {
+	Data       []instagram.Media `json:"data"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+func MediaHandler(store *cache.Store, syncer *mediasync.Syncer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		q := r.URL.Query()
 		w.Header().Set("Content-Type", "application/json")
 
 		ids := q.Get("ids")
-		log.Print("ids:", ids)
+		logger.Debug("media request", "ids", ids)
 		if ids != "" {
-			idlst := make([]string, 0, 4)
-			start := 0
-			for i := 0; i < len(ids); i++ {
-				if ids[i] == ',' {
-					idlst = append(idlst, ids[start:i])
-					start = i + 1
-				}
-			}
-			if start <= len(ids)-1 {
-				idlst = append(idlst, ids[start:])
+			idlst, err := parseMediaIDs(ids)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
 			}
 
 			// Check if requested IDs exist in cache
 			allExist, missing := store.HasMedia(idlst)
+			cacheLookups.WithLabelValues("hit").Add(float64(len(idlst) - len(missing)))
+			cacheLookups.WithLabelValues("miss").Add(float64(len(missing)))
 			if !allExist {
-				log.Printf("[CACHE] Missing media IDs: %v. Fetching fresh data...", missing)
-				if media, err := service.FetchMedia(); err == nil {
-					store.SetMedia(media)
-					log.Printf("[CACHE] Refreshed cache with %d media items", len(media))
-				} else {
-					log.Printf("[CACHE] Failed to refresh media: %v", err)
-				}
+				logger.Info("requested media missing from cache, fetching fresh data", "missing", missing)
+				syncer.RefreshMissing(missing)
 			}
 
 			json.NewEncoder(w).Encode(store.GetByIDs(idlst))
@@ -54,7 +70,145 @@ func MediaHandler(store *cache.Store, service *instagram.Service) http.HandlerFu
 			return
 		}
 
-		json.NewEncoder(w).Encode(store.GetAllMedia())
+		limitStr, cursor := q.Get("limit"), q.Get("cursor")
+		if limitStr == "" && cursor == "" && !hasMediaQuery(q) {
+			json.NewEncoder(w).Encode(store.GetAllMedia())
+			return
+		}
+
+		limit := defaultPageLimit
+		if limitStr != "" {
+			n, err := strconv.Atoi(limitStr)
+			if err != nil || n <= 0 {
+				writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+				return
+			}
+			limit = min(n, maxPageLimit)
+		}
+
+		query, err := parseMediaQuery(q)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		page, next, err := store.GetMediaPage(query, limit, cursor)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		json.NewEncoder(w).Encode(mediaPage{
+			Data:       page,
+			NextCursor: next,
+		})
+	}
+}
+
+// parseMediaIDs splits a comma-separated ?ids= list, dropping duplicates.
+// Every ID must be numeric, since unknown ones are looked up on Instagram.
+func parseMediaIDs(ids string) ([]string, error) {
+	parts := strings.Split(ids, ",")
+	idlst := make([]string, 0, len(parts))
+	seen := make(map[string]bool, len(parts))
+	for _, id := range parts {
+		if !instagram.ValidMediaID(id) {
+			return nil, fmt.Errorf("ids must be comma-separated numeric media IDs, got %q", id)
+		}
+		if !seen[id] {
+			seen[id] = true
+			idlst = append(idlst, id)
+		}
+	}
+	return idlst, nil
+}
+
+var mediaQueryParams = []string{"media_type", "username", "min_likes", "min_comments", "shared_to_feed", "sort"}
+
+func hasMediaQuery(q url.Values) bool {
+	for _, p := range mediaQueryParams {
+		if q.Has(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseMediaQuery builds a cache.Query from the filter and sort parameters of
+// a /media request
+func parseMediaQuery(q url.Values) (cache.Query, error) {
+	query := cache.Query{
+		MediaType: q.Get("media_type"),
+		Username:  q.Get("username"),
+		SortBy:    q.Get("sort"),
+	}
+
+	if !cache.ValidSort(query.SortBy) {
+		return query, fmt.Errorf("sort must be one of %s, %s, %s", cache.SortTimestamp, cache.SortLikes, cache.SortComments)
+	}
+
+	// Checked in order so the error names the same parameter every time
+	minimums := []struct {
+		param string
+		dst   *int
+	}{
+		{"min_likes", &query.MinLikes},
+		{"min_comments", &query.MinComments},
+	}
+	for _, m := range minimums {
+		if v := q.Get(m.param); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return query, fmt.Errorf("%s must be a non-negative integer", m.param)
+			}
+			*m.dst = n
+		}
+	}
+
+	if v := q.Get("shared_to_feed"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return query, fmt.Errorf("shared_to_feed must be true or false")
+		}
+		query.SharedToFeed = &b
+	}
+
+	return query, nil
+}
+
+// MediaSearchHandler searches cached captions by ?q= words (prefix matched,
+// #tag and @mention aware) and an exact ?tag= hashtag, sorted by ?sort=
+// relevance (the default with q) or recent, and paged like /media
+func MediaSearchHandler(store *cache.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+
+		limit := defaultPageLimit
+		if limitStr := q.Get("limit"); limitStr != "" {
+			n, err := strconv.Atoi(limitStr)
+			if err != nil || n <= 0 {
+				writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+				return
+			}
+			limit = min(n, maxPageLimit)
+		}
+
+		query := cache.SearchQuery{
+			Text:   q.Get("q"),
+			Tag:    q.Get("tag"),
+			SortBy: q.Get("sort"),
+		}
+		page, next, err := store.Search(query, limit, q.Get("cursor"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		json.NewEncoder(w).Encode(mediaPage{
+			Data:       page,
+			NextCursor: next,
+		})
 	}
 }
 
@@ -80,7 +234,8 @@ func MediaIdsHandler(store *cache.Store, service *instagram.Service) http.Handle
 	}
 }
 
-func ReadyHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
 }
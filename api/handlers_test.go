@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"backend-service/internal/cache"
+	"backend-service/internal/instagram"
+)
+
+func TestMediaSearchHandler(t *testing.T) {
+	store := cache.NewStore()
+	store.SetMedia([]instagram.Media{
+		{ID: "1", Timestamp: "2026-01-01", Caption: "Fasting and diabetes #IntermittentFasting"},
+		{ID: "2", Timestamp: "2026-01-02", Caption: "Recipes #intermittentfasting"},
+	})
+	handler := MediaSearchHandler(store)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/media/search?tag=intermittentfasting&limit=1", nil))
+
+	var page mediaPage
+	if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || len(page.Data) != 1 || page.Data[0].ID != "2" || page.NextCursor == "" {
+		t.Fatalf("expected the newest tagged post and a cursor, got %d %+v", rec.Code, page)
+	}
+
+	for _, target := range []string{"/media/search", "/media/search?q=diabetes&sort=likes"} {
+		rec = httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", target, rec.Code)
+		}
+	}
+}
+
+func TestParseMediaQueryReportsFirstInvalidMinimum(t *testing.T) {
+	q := url.Values{"min_likes": {"-1"}, "min_comments": {"x"}}
+	for range 20 {
+		if _, err := parseMediaQuery(q); err == nil || !strings.HasPrefix(err.Error(), "min_likes") {
+			t.Fatalf("expected min_likes to be reported first, got %v", err)
+		}
+	}
+}
+
+func TestMediaHandlerRejectsInvalidIDs(t *testing.T) {
+	handler := MediaHandler(cache.NewStore(), nil)
+	for _, ids := range []string{",", "1,,2", "1,abc", "1%3Ffields%3Dx"} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/media?ids="+ids, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("ids=%s: expected 400, got %d", ids, rec.Code)
+		}
+	}
+
+	if got, err := parseMediaIDs("2,1,2"); err != nil || len(got) != 2 || got[0] != "2" || got[1] != "1" {
+		t.Fatalf("expected duplicates to be dropped in order, got %v, %v", got, err)
+	}
+}
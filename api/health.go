@@ -0,0 +1,149 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"backend-service/internal/bootstrap"
+	"backend-service/internal/cache"
+)
+
+// checkTimeout bounds how long a single dependency check may take
+const checkTimeout = 2 * time.Second
+
+// Check statuses reported by /ready
+const (
+	CheckOK       = "ok"
+	CheckDegraded = "degraded"
+	CheckFailed   = "fail"
+)
+
+// Check is one dependency inspected by /ready. A failing critical check makes
+// the instance unready; a failing non-critical check is reported as degraded.
+type Check struct {
+	Name     string
+	Critical bool
+	Run      func(ctx context.Context) error
+}
+
+// degradedError marks a problem that is worth reporting but should not take
+// the instance out of rotation, even for a critical check
+type degradedError struct{ error }
+
+// Degraded wraps err so a check reports it without failing readiness
+func Degraded(err error) error {
+	return degradedError{err}
+}
+
+type checkResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type readiness struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+// HealthzHandler reports that the process is alive. It checks no
+// dependencies, so orchestrators do not restart instances for outages they
+// cannot fix.
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// ReadyHandler runs every check concurrently and answers 503 when a critical
+// check fails, with the result of each check in the body
+func ReadyHandler(checks ...Check) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		defer cancel()
+
+		results := make([]checkResult, len(checks))
+		var wg sync.WaitGroup
+		for i, c := range checks {
+			wg.Go(func() {
+				results[i] = runCheck(ctx, c)
+			})
+		}
+		wg.Wait()
+
+		body := readiness{Status: "ready", Checks: make(map[string]checkResult, len(checks))}
+		status := http.StatusOK
+		for i, c := range checks {
+			body.Checks[c.Name] = results[i]
+			if results[i].Status == CheckFailed {
+				body.Status = "not_ready"
+				status = http.StatusServiceUnavailable
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+func runCheck(ctx context.Context, c Check) checkResult {
+	err := c.Run(ctx)
+	var degraded degradedError
+	switch {
+	case err == nil:
+		return checkResult{Status: CheckOK}
+	case errors.As(err, &degraded) || !c.Critical:
+		return checkResult{Status: CheckDegraded, Error: err.Error()}
+	default:
+		return checkResult{Status: CheckFailed, Error: err.Error()}
+	}
+}
+
+// CacheCheck fails while the cache is empty and is degraded once it has not
+// been updated for an hour, since stale media can still be served
+func CacheCheck(store *cache.Store) Check {
+	return Check{
+		Name:     "cache",
+		Critical: true,
+		Run: func(context.Context) error {
+			if store.Len() == 0 {
+				return errors.New("media cache is empty")
+			}
+			if !store.IsFresh() {
+				return Degraded(fmt.Errorf("media cache last updated at %s", store.GetLastUpdateTime().Format(time.RFC3339)))
+			}
+			return nil
+		},
+	}
+}
+
+// PingCheck reports a dependency as failed when ping returns an error
+func PingCheck(name string, critical bool, ping func(ctx context.Context) error) Check {
+	return Check{Name: name, Critical: critical, Run: ping}
+}
+
+// TokenCheck fails once the access token has expired and is degraded while
+// refreshes are failing or expiry is less than a day away
+func TokenCheck(refresher *bootstrap.Refresher) Check {
+	return Check{
+		Name:     "token",
+		Critical: true,
+		Run: func(context.Context) error {
+			h := refresher.Health()
+			switch h.State {
+			case bootstrap.TokenExpired:
+				if h.ExpiresAt.IsZero() {
+					return errors.New("no access token")
+				}
+				return errors.New("access token has expired")
+			case bootstrap.TokenCritical, bootstrap.TokenWarning:
+				return Degraded(fmt.Errorf("access token is %s, expires at %s", h.State, h.ExpiresAt.Format(time.RFC3339)))
+			}
+			return nil
+		},
+	}
+}
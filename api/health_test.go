@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend-service/internal/bootstrap"
+	"backend-service/internal/cache"
+	"backend-service/internal/instagram"
+	"backend-service/internal/token"
+)
+
+func serveReady(t *testing.T, checks ...Check) (int, readiness) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	ReadyHandler(checks...).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+	var body readiness
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, body
+}
+
+func TestReadyReportsEachDependency(t *testing.T) {
+	store := cache.NewStore()
+	store.SetMedia([]instagram.Media{{ID: "1"}})
+
+	runtime := token.NewRuntime()
+	runtime.Set(token.Token{AccessToken: "tok", ExpiresAt: time.Now().Add(30 * 24 * time.Hour)})
+
+	code, body := serveReady(t,
+		CacheCheck(store),
+		PingCheck("redis", true, func(context.Context) error { return nil }),
+		PingCheck("postgres", false, func(context.Context) error { return errors.New("connection refused") }),
+		TokenCheck(&bootstrap.Refresher{Runtime: runtime}),
+	)
+
+	if code != http.StatusOK || body.Status != "ready" {
+		t.Fatalf("expected ready, got %d %+v", code, body)
+	}
+	want := map[string]string{"cache": CheckOK, "redis": CheckOK, "postgres": CheckDegraded, "token": CheckOK}
+	for name, status := range want {
+		if body.Checks[name].Status != status {
+			t.Errorf("%s: expected %s, got %+v", name, status, body.Checks[name])
+		}
+	}
+}
+
+func TestReadyFailsOnCriticalDependency(t *testing.T) {
+	cases := map[string]Check{
+		"empty cache":   CacheCheck(cache.NewStore()),
+		"redis down":    PingCheck("redis", true, func(context.Context) error { return errors.New("dial tcp: refused") }),
+		"expired token": TokenCheck(&bootstrap.Refresher{Runtime: token.NewRuntime()}),
+	}
+	for name, check := range cases {
+		code, body := serveReady(t, check)
+		if code != http.StatusServiceUnavailable || body.Status != "not_ready" {
+			t.Errorf("%s: expected 503 not_ready, got %d %+v", name, code, body)
+		}
+		if body.Checks[check.Name].Status != CheckFailed || body.Checks[check.Name].Error == "" {
+			t.Errorf("%s: expected failed check with error, got %+v", name, body.Checks[check.Name])
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"backend-service/internal/imaging"
+	"backend-service/internal/logging"
+	"backend-service/internal/mediasync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var imageDerivatives = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "image_derivatives_total",
+	Help: "Resized images served by /media/{id}/image by whether they came from the disk cache.",
+}, []string{"result"})
+
+// imageWidths are the widths derivatives are made in. Requests are rounded up
+// to the next one so the disk cache holds a handful of sizes per image.
+var imageWidths = []int{160, 320, 480, 640, 750, 1080}
+
+const defaultImageWidth = 640
+
+const (
+	// maxDerivations bounds how many images are decoded and resized at once.
+	// Each can hold a full-size decoded image plus its resized copy.
+	maxDerivations = 4
+	// derivationTimeout bounds one download, decode and resize. It is not tied
+	// to the request that started it, since others may be waiting on it.
+	derivationTimeout = 30 * time.Second
+)
+
+// MediaImageHandler serves the still image of the media named by the {id}
+// path value, resized to ?w= pixels wide and encoded as ?format= (jpeg, png
+// or webp). Derivatives are kept in cache, which may be nil to resize every time.
+func MediaImageHandler(assets *mediasync.Assets, cache *imaging.DiskCache) http.HandlerFunc {
+	var (
+		slots   = make(chan struct{}, maxDerivations)
+		flights derivationFlights
+	)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		q := r.URL.Query()
+		width := defaultImageWidth
+		if v := q.Get("w"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				writeError(w, http.StatusBadRequest, "w must be a positive integer")
+				return
+			}
+			width = snapWidth(n)
+		}
+		format, err := imaging.ParseFormat(q.Get("format"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		id := r.PathValue("id")
+		key := fmt.Sprintf("%s-w%d.%s", id, width, format)
+		etag := fmt.Sprintf("%q", "ig-"+key)
+		// Media that is not cached yet goes straight to the lookup below, which
+		// fetches it or reports it missing
+		if assets.Cached(id) {
+			if notModified(w, r, etag) {
+				return
+			}
+			if cache != nil {
+				if data, ok := cache.Get(key); ok {
+					imageDerivatives.WithLabelValues("hit").Inc()
+					serveImage(w, r, etag, format, data)
+					return
+				}
+			}
+		}
+		imageDerivatives.WithLabelValues("miss").Inc()
+
+		// Concurrent misses for one derivative share a single derivation
+		data, err := flights.do(r.Context(), key, func() ([]byte, error) {
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), derivationTimeout)
+			defer cancel()
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			data, err := derive(ctx, assets, id, width, format)
+			if err == nil && cache != nil {
+				if err := cache.Put(key, data); err != nil {
+					logger.Warn("failed to cache resized image", "id", id, logging.Err(err))
+				}
+			}
+			return data, err
+		})
+		if err != nil {
+			writeAssetError(w, id, err)
+			return
+		}
+		serveImage(w, r, etag, format, data)
+	}
+}
+
+func derive(ctx context.Context, assets *mediasync.Assets, id string, width int, format string) ([]byte, error) {
+	img, err := assets.Image(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return imaging.Derive(img, width, format)
+}
+
+// derivationFlights coalesces concurrent derivations of the same key
+type derivationFlights struct {
+	mu      sync.Mutex
+	running map[string]*derivation
+}
+
+// derivation is a derivation in progress that concurrent requests wait on
+type derivation struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// do runs fn for key, or waits for the run already in progress. A waiting
+// request gives up when ctx is done; the run itself carries on for the rest.
+func (f *derivationFlights) do(ctx context.Context, key string, fn func() ([]byte, error)) ([]byte, error) {
+	f.mu.Lock()
+	d, shared := f.running[key]
+	if !shared {
+		d = &derivation{done: make(chan struct{})}
+		if f.running == nil {
+			f.running = make(map[string]*derivation)
+		}
+		f.running[key] = d
+	}
+	f.mu.Unlock()
+
+	if !shared {
+		d.data, d.err = fn()
+		f.mu.Lock()
+		delete(f.running, key)
+		f.mu.Unlock()
+		close(d.done)
+		return d.data, d.err
+	}
+
+	select {
+	case <-d.done:
+		return d.data, d.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func serveImage(w http.ResponseWriter, r *http.Request, etag, format string, data []byte) {
+	w.Header().Set("Content-Type", imaging.ContentType(format))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", contentCacheControl)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
+
+// snapWidth rounds w up to the next derivative width
+func snapWidth(w int) int {
+	for _, size := range imageWidths {
+		if w <= size {
+			return size
+		}
+	}
+	return imageWidths[len(imageWidths)-1]
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"backend-service/internal/cache"
+	"backend-service/internal/imaging"
+	"backend-service/internal/instagram"
+	"backend-service/internal/mediasync"
+)
+
+func TestMediaImageResizesAndCaches(t *testing.T) {
+	photo := image.NewRGBA(image.Rect(0, 0, 1080, 1350))
+	for i := range photo.Pix {
+		photo.Pix[i] = 200
+	}
+	var original bytes.Buffer
+	if err := jpeg.Encode(&original, photo, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var cdnCalls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cdnCalls.Add(1)
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(original.Bytes())
+	}))
+	defer srv.Close()
+
+	store := cache.NewStore()
+	store.SetMedia([]instagram.Media{{ID: "42", MediaType: "IMAGE", MediaURL: srv.URL + "/photo.jpg"}})
+	assets := &mediasync.Assets{Syncer: &mediasync.Syncer{Store: store}, Client: srv.Client()}
+	derivatives, err := imaging.NewDiskCache(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes := http.NewServeMux()
+	routes.Handle("/media/{id}/image", MediaImageHandler(assets, derivatives))
+
+	for range 2 {
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/media/42/image?w=300&format=jpeg", nil))
+
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/jpeg" {
+			t.Fatalf("expected a JPEG, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+		}
+		cfg, err := jpeg.DecodeConfig(rec.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Width != 320 || cfg.Height != 400 {
+			t.Fatalf("expected w=300 to be served at 320x400, got %dx%d", cfg.Width, cfg.Height)
+		}
+	}
+	if cdnCalls.Load() != 1 {
+		t.Fatalf("expected the second request to come from the disk cache, got %d CDN calls", cdnCalls.Load())
+	}
+
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/media/42/image?w=320&format=webp", nil))
+	if body := rec.Body.Bytes(); rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/webp" ||
+		len(body) < 12 || string(body[:4]) != "RIFF" || string(body[8:12]) != "WEBP" {
+		t.Fatalf("expected a WebP, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/media/42/image?w=320&format=avif", nil))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "avif") {
+		t.Fatalf("expected avif to be rejected, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	// The same download gives the placeholder in the /media JSON
+	assets.FillPlaceholders(context.Background())
+	got := store.GetByIDs([]string{"42"})[0]
+	if got.Width != 1080 || got.Height != 1350 || got.BlurHash == "" || got.LQIP == "" {
+		t.Fatalf("expected dimensions and placeholders, got %+v", got.Placeholder)
+	}
+}
+
+func TestSnapWidth(t *testing.T) {
+	for w, want := range map[int]int{1: 160, 320: 320, 321: 480, 5000: 1080} {
+		if got := snapWidth(w); got != want {
+			t.Errorf("snapWidth(%d) = %d, want %d", w, got, want)
+		}
+	}
+}
+
+func TestMediaImageCoalescesConcurrentMisses(t *testing.T) {
+	var original bytes.Buffer
+	if err := jpeg.Encode(&original, image.NewRGBA(image.Rect(0, 0, 640, 640)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var cdnCalls atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cdnCalls.Add(1)
+		<-release
+		w.Write(original.Bytes())
+	}))
+	defer srv.Close()
+
+	store := cache.NewStore()
+	store.SetMedia([]instagram.Media{{ID: "42", MediaType: "IMAGE", MediaURL: srv.URL + "/photo.jpg"}})
+	assets := &mediasync.Assets{Syncer: &mediasync.Syncer{Store: store}, Client: srv.Client()}
+
+	routes := http.NewServeMux()
+	routes.Handle("/media/{id}/image", MediaImageHandler(assets, nil))
+
+	var wg sync.WaitGroup
+	codes := make([]int, 5)
+	for i := range codes {
+		wg.Go(func() {
+			rec := httptest.NewRecorder()
+			routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/media/42/image?w=320", nil))
+			codes[i] = rec.Code
+		})
+	}
+	// Give every request a chance to join the derivation in progress
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i, code)
+		}
+	}
+	if cdnCalls.Load() != 1 {
+		t.Fatalf("expected one download for concurrent requests, got %d", cdnCalls.Load())
+	}
+}
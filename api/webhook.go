@@ -0,0 +1,169 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"backend-service/internal/logging"
+	"backend-service/internal/mediasync"
+	"backend-service/internal/scheduler"
+)
+
+// maxWebhookBody caps the size of webhook payloads we are willing to read
+const maxWebhookBody = 1 << 20
+
+// webhookPayload is the envelope Meta sends for Instagram webhook events
+type webhookPayload struct {
+	Object string `json:"object"`
+	Entry  []struct {
+		ID      string `json:"id"`
+		Changes []struct {
+			Field string        `json:"field"`
+			Value webhookChange `json:"value"`
+		} `json:"changes"`
+	} `json:"entry"`
+}
+
+// webhookChange covers the value shapes that reference a media object:
+// media events carry media_id directly, comments and mentions nest it under media.
+type webhookChange struct {
+	Verb    string `json:"verb"`
+	MediaID string `json:"media_id"`
+	Media   struct {
+		ID string `json:"id"`
+	} `json:"media"`
+}
+
+func (c webhookChange) mediaID() string {
+	if c.MediaID != "" {
+		return c.MediaID
+	}
+	return c.Media.ID
+}
+
+func (c webhookChange) isDelete() bool {
+	switch strings.ToLower(c.Verb) {
+	case "remove", "delete", "deleted":
+		return true
+	}
+	return false
+}
+
+// WebhookHandler receives Instagram webhook events. GET requests answer the
+// hub.challenge subscription handshake; POST requests are verified against
+// X-Hub-Signature-256 and upsert or delete the referenced media through the
+// syncer of the account the event is for. syncers is keyed by Instagram user
+// ID; with a single account every event goes to it. Events are applied after
+// the response in goroutines tracked by jobs, so shutdown waits for them
+// before persisting.
+func WebhookHandler(syncers map[string]*mediasync.Syncer, jobs *scheduler.Jobs, appSecret, verifyToken string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			q := r.URL.Query()
+			if verifyToken == "" || q.Get("hub.mode") != "subscribe" ||
+				!hmac.Equal([]byte(q.Get("hub.verify_token")), []byte(verifyToken)) {
+				writeError(w, http.StatusForbidden, "verification failed")
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(q.Get("hub.challenge")))
+
+		case http.MethodPost:
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "failed to read body")
+				return
+			}
+
+			if !validSignature(appSecret, body, r.Header.Get("X-Hub-Signature-256")) {
+				logger.Warn("rejected webhook payload with invalid signature", "handler", "webhook")
+				writeError(w, http.StatusUnauthorized, "invalid signature")
+				return
+			}
+
+			var payload webhookPayload
+			if err := json.Unmarshal(body, &payload); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid payload")
+				return
+			}
+
+			// Acknowledge immediately; Meta retries deliveries that take too long
+			w.WriteHeader(http.StatusOK)
+			jobs.Go(func() { applyWebhook(syncers, payload) })
+
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// validSignature checks an X-Hub-Signature-256 header ("sha256=<hex>")
+// against the HMAC-SHA256 of body keyed with the app secret
+func validSignature(appSecret string, body []byte, header string) bool {
+	if appSecret == "" {
+		return false
+	}
+	sig, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(appSecret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+func applyWebhook(syncers map[string]*mediasync.Syncer, payload webhookPayload) {
+	if payload.Object != "instagram" {
+		logger.Info("ignoring webhook event", "handler", "webhook", "object", payload.Object)
+		return
+	}
+
+	for _, entry := range payload.Entry {
+		syncer := syncerFor(syncers, entry.ID)
+		if syncer == nil {
+			logger.Warn("ignoring webhook event for unknown account", "handler", "webhook", "ig_user_id", entry.ID)
+			continue
+		}
+		for _, change := range entry.Changes {
+			id := change.Value.mediaID()
+			if id == "" {
+				continue
+			}
+
+			if change.Value.isDelete() {
+				syncer.DeleteMedia(id)
+				continue
+			}
+
+			if err := syncer.UpsertMedia(id); err != nil {
+				logger.Error("failed to fetch media for webhook event", "handler", "webhook", "media_id", id, "field", change.Field, logging.Err(err))
+			}
+		}
+	}
+}
+
+// syncerFor returns the syncer for an Instagram user ID, or the only syncer
+// when there is one
+func syncerFor(syncers map[string]*mediasync.Syncer, igUserID string) *mediasync.Syncer {
+	if s, ok := syncers[igUserID]; ok {
+		return s
+	}
+	if len(syncers) == 1 {
+		for _, s := range syncers {
+			return s
+		}
+	}
+	return nil
+}
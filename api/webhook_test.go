@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"backend-service/internal/cache"
+	"backend-service/internal/instagram"
+	"backend-service/internal/mediasync"
+	"backend-service/internal/scheduler"
+	"backend-service/internal/token"
+)
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookVerificationChallenge(t *testing.T) {
+	handler := WebhookHandler(map[string]*mediasync.Syncer{"1784": {}}, new(scheduler.Jobs), "secret", "verify-me")
+
+	req := httptest.NewRequest(http.MethodGet, "/webhooks/instagram?hub.mode=subscribe&hub.verify_token=verify-me&hub.challenge=42", nil)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "42" {
+		t.Fatalf("expected 200 with challenge, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/webhooks/instagram?hub.mode=subscribe&hub.verify_token=wrong&hub.challenge=42", nil)
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for wrong verify token, got %d", rec.Code)
+	}
+}
+
+func TestWebhookRejectsInvalidSignature(t *testing.T) {
+	handler := WebhookHandler(map[string]*mediasync.Syncer{"1784": {}}, new(scheduler.Jobs), "secret", "verify-me")
+	body := `{"object":"instagram","entry":[]}`
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/instagram", strings.NewReader(body))
+	req.Header.Set("X-Hub-Signature-256", sign("other-secret", body))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/webhooks/instagram", strings.NewReader(body))
+	req.Header.Set("X-Hub-Signature-256", sign("secret", body))
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+}
+
+func TestWebhookEventsAreTrackedByJobs(t *testing.T) {
+	store := cache.NewStore()
+	store.SetMedia([]instagram.Media{{ID: "7"}})
+	var jobs scheduler.Jobs
+	handler := WebhookHandler(map[string]*mediasync.Syncer{"1784": {Store: store}}, &jobs, "secret", "verify-me")
+	body := `{"object":"instagram","entry":[{"id":"1784","changes":[{"field":"media","value":{"media_id":"7","verb":"remove"}}]}]}`
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/instagram", strings.NewReader(body))
+	req.Header.Set("X-Hub-Signature-256", sign("secret", body))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if err := jobs.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if store.Len() != 0 {
+		t.Fatalf("expected the event to be applied once jobs are drained, got %d items", store.Len())
+	}
+}
+
+func TestSyncerForRoutesByAccount(t *testing.T) {
+	clinic, kids := &mediasync.Syncer{}, &mediasync.Syncer{}
+
+	single := map[string]*mediasync.Syncer{"1784": clinic}
+	if syncerFor(single, "other") != clinic {
+		t.Fatal("expected a single account to receive every event")
+	}
+
+	both := map[string]*mediasync.Syncer{"1784": clinic, "1785": kids}
+	if syncerFor(both, "1785") != kids {
+		t.Fatal("expected events to be routed by Instagram user ID")
+	}
+	if syncerFor(both, "other") != nil {
+		t.Fatal("expected no syncer for an unknown account")
+	}
+}
+
+func TestApplyWebhookUpsertsAndDeletesPerAccount(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/42", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"id": "42", "media_type": "IMAGE", "caption": "new post", "owner": map[string]string{"id": "1785"}})
+	})
+	// Instagram answers a lookup of a deleted post with code 100, subcode 33
+	mux.HandleFunc("/7", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"message":"Unsupported get request.","type":"GraphMethodException","code":100,"error_subcode":33}}`))
+	})
+
+	rt := token.NewRuntime()
+	rt.Set(token.Token{AccessToken: "TEST_TOKEN"})
+	newSyncer := func(igUserID string, media ...instagram.Media) *mediasync.Syncer {
+		store := cache.NewStore()
+		store.SetMedia(media)
+		return &mediasync.Syncer{
+			Store:   store,
+			Service: &instagram.Service{Client: srv.Client(), BaseURL: srv.URL, IgUserID: igUserID, TokenStore: rt},
+		}
+	}
+	clinic := newSyncer("1784", instagram.Media{ID: "7"}, instagram.Media{ID: "8"})
+	kids := newSyncer("1785")
+
+	var payload webhookPayload
+	if err := json.Unmarshal([]byte(`{"object":"instagram","entry":[
+		{"id":"1785","changes":[{"field":"media","value":{"media_id":"42"}}]},
+		{"id":"1784","changes":[
+			{"field":"media","value":{"media_id":"7"}},
+			{"field":"media","value":{"media_id":"8","verb":"remove"}}
+		]}
+	]}`), &payload); err != nil {
+		t.Fatal(err)
+	}
+	applyWebhook(map[string]*mediasync.Syncer{"1784": clinic, "1785": kids}, payload)
+
+	if got := kids.Store.GetByIDs([]string{"42"}); len(got) != 1 || got[0].Caption != "new post" {
+		t.Fatalf("expected the new post in the account the entry is for, got %+v", got)
+	}
+	if got := clinic.Store.GetByIDs([]string{"42"}); len(got) != 0 {
+		t.Fatalf("expected the other account to be left alone, got %+v", got)
+	}
+	if clinic.Store.Len() != 0 {
+		t.Fatalf("expected media Instagram no longer has and removed media to be deleted, got %d items", clinic.Store.Len())
+	}
+}
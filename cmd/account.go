@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"backend-service/api"
+	"backend-service/internal/archive"
+	"backend-service/internal/bootstrap"
+	"backend-service/internal/cache"
+	"backend-service/internal/config"
+	"backend-service/internal/instagram"
+	"backend-service/internal/logging"
+	"backend-service/internal/mediasync"
+	"backend-service/internal/scheduler"
+	"backend-service/internal/token"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// backends are the shared connections every account keeps its state in.
+// Either may be nil when that backend is not available.
+type backends struct {
+	redis redis.UniversalClient
+	db    *sql.DB
+}
+
+// account is one Instagram account with its own token lifecycle, media cache
+// and storage keys
+type account struct {
+	name     string
+	igUserID string
+	log      *slog.Logger
+
+	store         *cache.Store
+	snapshot      cache.SnapshotStore
+	redisSnapshot *cache.RedisSnapshot
+	redisTokenKey string
+
+	runtime   *token.TokenRuntime
+	refresher *bootstrap.Refresher
+	service   *instagram.Service
+	syncer    *mediasync.Syncer
+	assets    *mediasync.Assets
+	archive   *archive.Repository
+}
+
+// accountKey namespaces a Redis key or file name by account. The default
+// account keeps the single-account names so existing deployments carry on.
+func accountKey(base, name string) string {
+	if name == config.DefaultAccount {
+		return base
+	}
+	return base + ":" + name
+}
+
+func accountFile(base, name string) string {
+	if name == config.DefaultAccount {
+		return base
+	}
+	ext := ".json"
+	return strings.TrimSuffix(base, ext) + "." + name + ext
+}
+
+// setupAccount restores the account's media from its last snapshot, loads or
+// refreshes its token and fetches its media if the snapshot was empty.
+// Cancelling ctx cuts the token refresh and the fetch retries short.
+func setupAccount(
+	ctx context.Context,
+	cfg config.Config,
+	acct config.Account,
+	b backends,
+	client *http.Client,
+	cdn *http.Client,
+	provider instagram.Provider,
+) (*account, error) {
+	a := &account{
+		name:          acct.Name,
+		igUserID:      acct.IgUserID,
+		log:           logging.Component("main").With("account", acct.Name),
+		store:         cache.NewStore(),
+		snapshot:      cache.NewDiskSnapshot(accountFile("media_snapshot.json", acct.Name)),
+		redisTokenKey: accountKey(cfg.RedisTokenKey, acct.Name),
+		runtime:       token.NewRuntime(),
+	}
+
+	tokenSources := []token.Source{
+		token.NewDiskSource(accountFile("token.json", acct.Name)),
+	}
+	if b.redis != nil {
+		a.redisSnapshot = cache.NewRedisSnapshot(b.redis, accountKey(cfg.RedisMediaKey, acct.Name))
+		a.snapshot = a.redisSnapshot
+		tokenSources = append(tokenSources, token.NewRedisSourceFor(b.redis, a.redisTokenKey))
+	}
+	if b.db != nil {
+		a.archive = archive.NewRepository(b.db, acct.Name)
+		tokenSources = append(tokenSources, token.NewPostgresSource(b.db, acct.Name))
+	}
+
+	// Warm the cache from the last snapshot so we can serve before Instagram answers
+	if snap, err := a.snapshot.Load(); err == nil {
+		a.store.Restore(snap)
+	} else if !errors.Is(err, redis.Nil) && !errors.Is(err, os.ErrNotExist) {
+		a.log.Error("failed to load media snapshot", logging.Err(err))
+	}
+	a.store.SetPersister(a.snapshot)
+
+	tokenChain, err := token.NewChain(cfg.TokenSources, tokenSources...)
+	if err != nil {
+		a.log.Warn("token source configuration", logging.Err(err))
+	}
+	if len(tokenChain) == 0 {
+		return nil, errors.New("no token sources available")
+	}
+
+	// An account without a usable token still starts, so the others keep
+	// serving and a token can be installed through the admin API. Its token
+	// check keeps /ready failing until then.
+	hasToken := true
+	if err := bootstrap.InitToken(ctx, a.runtime, tokenChain, client, provider); err != nil {
+		a.log.Error("no usable access token, install one through the admin token API", logging.Err(err))
+		hasToken = false
+	}
+
+	a.service = &instagram.Service{
+		Client:     client,
+		BaseURL:    provider.MediaBaseURL(),
+		IgUserID:   acct.IgUserID,
+		TokenStore: a.runtime,
+	}
+
+	a.syncer = &mediasync.Syncer{
+		Store:          a.store,
+		Service:        a.service,
+		ReconcileEvery: cfg.MediaReconcileInterval,
+	}
+	if a.archive != nil {
+		a.syncer.Archive = a.archive
+	}
+	a.assets = &mediasync.Assets{Syncer: a.syncer, Client: cdn}
+
+	// Initial media sync at bootstrap. A warm cache is reconciled by the
+	// scheduler's first run instead of blocking startup.
+	const maxAttempts = 3
+	warm := a.store.Len() > 0
+	switch {
+	case warm:
+		a.log.Info("serving media from snapshot", "count", a.store.Len())
+	case !hasToken:
+		a.log.Warn("skipping initial media fetch without an access token")
+	default:
+		a.log.Info("fetching initial media")
+	}
+	for i := 1; i <= maxAttempts && !warm && hasToken; i++ {
+		err := a.syncer.Reconcile()
+		if err == nil {
+			a.log.Info("cached initial media", "count", a.store.Len())
+			break
+		}
+		a.log.Warn("initial media fetch failed", "attempt", i, "max_attempts", maxAttempts, logging.Err(err))
+		if i == maxAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return a, ctx.Err()
+		case <-time.After(time.Duration(i) * time.Second):
+		}
+	}
+
+	// Instagram and the snapshot both came up empty; fall back to the archive
+	a.syncer.RestoreFromArchive()
+
+	a.refresher = &bootstrap.Refresher{
+		Runtime:  a.runtime,
+		Chain:    tokenChain,
+		Client:   client,
+		Provider: provider,
+	}
+	if b.redis != nil {
+		a.refresher.Lock = token.NewRedisLockFor(b.redis, a.redisTokenKey, bootstrap.LeaseTTL(client))
+	}
+	return a, nil
+}
+
+// start runs the account's media sync and token refresh schedulers, and
+// follows other replicas' media saves and token refreshes through Redis. Each
+// sync is followed by computing placeholders for media that has none.
+func (a *account) start(ctx context.Context, jobs *scheduler.Jobs, cfg config.Config, b backends) {
+	jobs.StartMediaSync(ctx, cfg.MediaSyncInterval, func() {
+		if a.runtime.Get() == "" {
+			a.log.Warn("skipping media sync without an access token")
+			return
+		}
+		a.syncer.Run()
+		a.assets.FillPlaceholders(ctx)
+	})
+	jobs.StartExpiryRefresh(ctx, a.refresher)
+	if a.redisSnapshot != nil {
+		jobs.Go(func() { a.redisSnapshot.Subscribe(ctx, a.store) })
+		jobs.Go(func() { token.WatchRedisFor(ctx, b.redis, a.redisTokenKey, a.runtime, a.refresher.Chain) })
+	}
+}
+
+// checks are the account's readiness checks, named after the account unless
+// it is the default one
+func (a *account) checks() []api.Check {
+	checks := []api.Check{api.CacheCheck(a.store), api.TokenCheck(a.refresher)}
+	if a.name != config.DefaultAccount {
+		for i := range checks {
+			checks[i].Name += ":" + a.name
+		}
+	}
+	return checks
+}
+
+// persist saves the final media snapshot and token on shutdown
+func (a *account) persist() {
+	// An empty store would overwrite the last good snapshot
+	if a.store.Len() > 0 {
+		if err := a.snapshot.Save(a.store.Snapshot()); err != nil {
+			a.log.Error("failed to save final media snapshot", logging.Err(err))
+		}
+	}
+	if err := a.refresher.Persist(); err != nil {
+		logSaveErrors(a.log, err)
+	}
+}
@@ -2,98 +2,318 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"backend-service/api"
-	"backend-service/internal/bootstrap"
-	"backend-service/internal/cache"
 	"backend-service/internal/config"
+	"backend-service/internal/imaging"
 	"backend-service/internal/instagram"
+	"backend-service/internal/logging"
+	"backend-service/internal/mediasync"
 	"backend-service/internal/scheduler"
 	"backend-service/internal/token"
 	"backend-service/middleware"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
-	cfg := config.LoadConfig()
-	store := cache.NewStore()
+	os.Exit(run())
+}
 
-	redisClient, err := config.ConnectRedis()
+// run starts the service and blocks until it has shut down, returning the
+// process exit code. Deferred cleanups run before main exits with it.
+func run() int {
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "optional JSON or YAML config file; environment variables take precedence")
+	printConfig := flag.Bool("print-config", false, "print the resolved configuration with secrets masked and exit")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if *printConfig {
+		config.Print(os.Stdout, cfg)
+	}
 	if err != nil {
-		log.Fatal("failed to connect to Redis:", err)
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		return 1
+	}
+	if *printConfig {
+		return 0
 	}
-	defer redisClient.Close()
 
-	runtimeToken := token.NewRuntime()
+	logging.Setup(cfg.LogLevel)
+	for _, secret := range config.Secrets(cfg) {
+		logging.AddSecret(secret)
+	}
+	logger := logging.Component("main")
 
-	client := instagram.NewClient()
+	token.UseRedisKey(cfg.RedisTokenKey)
 
-	// Bootstrap
-	if err := bootstrap.InitToken(
-		runtimeToken,
-		redisClient,
-		client,
-		"token.json",
-	); err != nil {
-		log.Fatal("[BOOTSTRAP] ", err)
+	var (
+		shared backends
+		checks []api.Check
+	)
+
+	// Redis is optional. Without it media snapshots are kept on disk, and
+	// replicas neither share a refresh lease nor hear about each other's
+	// token refreshes and media saves.
+	redisClient, err := config.ConnectRedis(cfg)
+	switch {
+	case errors.Is(err, config.ErrRedisNotConfigured):
+		logger.Warn("Redis not configured, running on disk and PostgreSQL only")
+	case err != nil:
+		logger.Warn("Redis unavailable, running on disk and PostgreSQL only", logging.Err(err))
+		bootErr := fmt.Errorf("unavailable at startup: %w", err)
+		checks = append(checks, api.PingCheck("redis", false, func(context.Context) error {
+			return bootErr
+		}))
+	default:
+		defer redisClient.Close()
+		checks = append(checks, api.PingCheck("redis", false, func(ctx context.Context) error {
+			return redisClient.Ping(ctx).Err()
+		}))
+		shared.redis = redisClient
 	}
 
-	service := instagram.Service{
-		Client:     client,
-		IgUserID:   cfg.IgUserID,
-		TokenStore: runtimeToken,
+	keyring, err := token.LoadKeyring(cfg.TokenEncryptionKeys, cfg.TokenEncryptionKeyFile)
+	if err != nil {
+		logging.Fatal(logger, "invalid token encryption keys", logging.Err(err))
+	}
+	if keyring == nil {
+		logger.Warn("TOKEN_ENCRYPTION_KEYS not set, tokens are stored in plaintext")
 	}
+	token.UseKeyring(keyring)
 
-	// Initial media sync at bootstrap
-	log.Println("[BOOTSTRAP] Fetching initial media...")
-	const maxAttempts = 3
-	for i := 1; i <= maxAttempts; i++ {
-		media, err := service.FetchMedia()
+	// Postgres is optional; without DATABASE_URL we run on disk and Redis alone
+	if cfg.DatabaseURL != "" {
+		db, err := config.ConnectPostgres(cfg.DatabaseURL)
 		if err == nil {
-			store.SetMedia(media)
-			log.Printf("[BOOTSTRAP] Successfully cached %d media items", len(media))
-			break
+			err = db.Ping()
 		}
-		log.Printf("[BOOTSTRAP] Media fetch attempt %d/%d failed: %v", i, maxAttempts, err)
-		if i < maxAttempts {
-			time.Sleep(time.Duration(i) * time.Second)
+		if err != nil {
+			logger.Warn("PostgreSQL unavailable", logging.Err(err))
+			bootErr := fmt.Errorf("unavailable at startup: %w", err)
+			checks = append(checks, api.PingCheck("postgres", false, func(context.Context) error {
+				return bootErr
+			}))
+		} else {
+			checks = append(checks, api.PingCheck("postgres", false, db.PingContext))
+			defer db.Close()
+			shared.db = db
 		}
 	}
 
-	refTok := func() {
-		if runtimeToken.IsValid() {
-			newToken, err := instagram.RefreshAccessToken(client, runtimeToken.Get())
-			if err != nil {
-				log.Printf("failed to refresh token: %v", err)
-				return
-			}
-			runtimeToken.Set(newToken)
-			token.SaveToDisk("token.json", &newToken)
-			token.SaveToRedis(redisClient, newToken)
+	client := instagram.NewClient()
+	var provider instagram.Provider = instagram.App{BaseURL: cfg.FBAPIBaseURL, ID: cfg.AppID, Secret: cfg.AppSecret}
+	if cfg.LoginProvider == instagram.ProviderInstagram {
+		provider = instagram.InstagramLogin{BaseURL: cfg.IGGraphAPIBaseURL, Version: cfg.IGGraphAPIVersion}
+	}
+	logger.Info("using login provider", "provider", provider.Name(), "media_base_url", provider.MediaBaseURL())
 
-			log.Printf("[TOKEN] refreshed access token")
-		} else {
-			log.Printf("[TOKEN] access token is still valid, no need to refresh")
+	// Assets are streamed from Instagram's CDN for as long as the client reads,
+	// so the CDN client has no overall timeout and skips the Graph API layers
+	cdnClient := mediasync.NewCDNClient()
+
+	// Resized images are shared by all accounts; a collab post is one image
+	var derivatives *imaging.DiskCache
+	if cfg.ImageCacheDir != "" {
+		derivatives, err = imaging.NewDiskCache(cfg.ImageCacheDir, int64(cfg.ImageCacheSizeMB)<<20)
+		if err != nil {
+			logger.Warn("image cache unavailable, resizing on every request", logging.Err(err))
+			derivatives = nil
 		}
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	// Start scheduler for token refresh only (media is fetched on-demand)
-	scheduler.StartTokenRefresh(ctx, refTok)
-	defer cancel()
+	// SIGINT and SIGTERM cancel ctx, which interrupts account bootstrap, stops
+	// the schedulers and starts shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Bootstrap every account; the first one also answers the unprefixed routes
+	accounts := make([]*account, 0, len(cfg.Accounts))
+	for _, acct := range cfg.Accounts {
+		a, err := setupAccount(ctx, cfg, acct, shared, client, cdnClient, provider)
+		if ctx.Err() != nil {
+			logger.Info("shutdown requested during startup")
+			return 0
+		}
+		if err != nil {
+			logging.Fatal(logger, "failed to initialize account", "account", acct.Name, logging.Err(err))
+		}
+		accounts = append(accounts, a)
+		checks = append(checks, a.checks()...)
+	}
+	primary := accounts[0]
+
+	// Start schedulers for incremental media sync and expiry-driven token refresh
+	var jobs scheduler.Jobs
+	for _, a := range accounts {
+		a.start(ctx, &jobs, cfg, shared)
+	}
+
+	registerGauges(accounts)
+	if derivatives != nil {
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "image_cache_bytes",
+			Help: "Bytes of resized images in the disk cache.",
+		}, func() float64 {
+			return float64(derivatives.Size())
+		})
+	}
 
 	mux := http.NewServeMux()
+	handle := func(route string, h http.Handler) {
+		mux.Handle(route, middleware.Metrics(route, h))
+	}
 
-	mux.HandleFunc("/media", api.MediaHandler(store, &service))
-	mux.HandleFunc("/media/getIdsOnly", api.MediaIdsHandler(store, &service))
-	mux.HandleFunc("/ready", api.ReadyHandler)
+	var (
+		mediaHandlers     = make(map[string]http.Handler, len(accounts))
+		mediaIdsHandlers  = make(map[string]http.Handler, len(accounts))
+		searchHandlers    = make(map[string]http.Handler, len(accounts))
+		contentHandlers   = make(map[string]http.Handler, len(accounts))
+		imageHandlers     = make(map[string]http.Handler, len(accounts))
+		captionHandlers   = make(map[string]http.Handler, len(accounts))
+		tokenHandlers     = make(map[string]http.Handler, len(accounts))
+		tokenRefreshers   = make(map[string]http.Handler, len(accounts))
+		syncersByIgUserID = make(map[string]*mediasync.Syncer, len(accounts))
+	)
+	for _, a := range accounts {
+		mediaHandlers[a.name] = api.MediaHandler(a.store, a.syncer)
+		mediaIdsHandlers[a.name] = api.MediaIdsHandler(a.store, a.service)
+		searchHandlers[a.name] = api.MediaSearchHandler(a.store)
+		contentHandlers[a.name] = api.MediaContentHandler(a.assets)
+		imageHandlers[a.name] = api.MediaImageHandler(a.assets, derivatives)
+		if a.archive != nil {
+			captionHandlers[a.name] = api.MediaCaptionsHandler(a.archive)
+		}
+		tokenHandlers[a.name] = api.AdminTokenHandler(a.refresher)
+		tokenRefreshers[a.name] = api.AdminTokenRefreshHandler(a.refresher)
+		syncersByIgUserID[a.igUserID] = a.syncer
+	}
+
+	handle("/media", mediaHandlers[primary.name])
+	handle("/media/getIdsOnly", mediaIdsHandlers[primary.name])
+	handle("/media/search", searchHandlers[primary.name])
+	handle("/media/{id}/content", contentHandlers[primary.name])
+	handle("/media/{id}/image", imageHandlers[primary.name])
+	handle("/accounts/{name}/media", api.AccountHandler(mediaHandlers))
+	handle("/accounts/{name}/media/getIdsOnly", api.AccountHandler(mediaIdsHandlers))
+	handle("/accounts/{name}/media/search", api.AccountHandler(searchHandlers))
+	handle("/accounts/{name}/media/{id}/content", api.AccountHandler(contentHandlers))
+	handle("/accounts/{name}/media/{id}/image", api.AccountHandler(imageHandlers))
+	// Caption history is recorded by the archive, so it needs PostgreSQL
+	if shared.db != nil {
+		handle("/media/{id}/captions", captionHandlers[primary.name])
+		handle("/accounts/{name}/media/{id}/captions", api.AccountHandler(captionHandlers))
+	}
+	handle("/ready", api.ReadyHandler(checks...))
+	handle("/healthz", http.HandlerFunc(api.HealthzHandler))
+	handle("/webhooks/instagram", api.WebhookHandler(syncersByIgUserID, &jobs, cfg.AppSecret, cfg.WebhookVerifyToken))
+	mux.Handle("/metrics", promhttp.Handler())
 
-	handler := middleware.CORS(mux)
+	if cfg.AdminAPIKey != "" {
+		admin := func(h http.Handler) http.Handler { return middleware.AdminAuth(cfg.AdminAPIKey, h) }
+		handle("/admin/token", admin(tokenHandlers[primary.name]))
+		handle("/admin/token/refresh", admin(tokenRefreshers[primary.name]))
+		handle("/admin/accounts/{name}/token", admin(api.AccountHandler(tokenHandlers)))
+		handle("/admin/accounts/{name}/token/refresh", admin(api.AccountHandler(tokenRefreshers)))
+	} else {
+		logger.Info("ADMIN_API_KEY not set, admin endpoints disabled")
+	}
+
+	server := &http.Server{
+		Addr:    ":" + cfg.Port,
+		Handler: middleware.CORS(mux),
+	}
 
-	log.Printf("Started server on %s", cfg.Port)
-	if err := http.ListenAndServe(":"+cfg.Port, handler); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("started server", "port", cfg.Port, "accounts", len(accounts))
+		serverErr <- server.ListenAndServe()
+	}()
+
+	exitCode := 0
+	select {
+	case err := <-serverErr:
+		logger.Error("server failed", logging.Err(err))
+		exitCode = 1
+		stop()
+	case <-ctx.Done():
+		logger.Info("shutting down", "timeout", cfg.ShutdownTimeout.String())
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Stop accepting connections and let in-flight requests finish
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("HTTP server did not shut down cleanly", logging.Err(err))
+	}
+
+	// Let a running sync, token refresh or webhook event complete before persisting
+	if err := jobs.Wait(shutdownCtx); err != nil {
+		logger.Error("background jobs did not finish before the shutdown timeout", logging.Err(err))
+	}
+
+	for _, a := range accounts {
+		a.persist()
+	}
+
+	logger.Info("shutdown complete")
+	return exitCode
+}
+
+// logSaveErrors reports each token source that failed to persist on shutdown
+func logSaveErrors(logger *slog.Logger, err error) {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			logger.Error("failed to save token on shutdown", logging.Err(e))
+		}
+		return
+	}
+	logger.Error("failed to save token on shutdown", logging.Err(err))
+}
+
+// registerGauges exposes cache and token state that is read at scrape time,
+// one series per account
+func registerGauges(accounts []*account) {
+	for _, a := range accounts {
+		store, runtime := a.store, a.runtime
+		labels := prometheus.Labels{"account": a.name}
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "cache_media_items",
+			Help:        "Media items currently cached.",
+			ConstLabels: labels,
+		}, func() float64 {
+			return float64(store.Len())
+		})
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "cache_age_seconds",
+			Help:        "Seconds since the media cache was last updated, +Inf if it never was.",
+			ConstLabels: labels,
+		}, func() float64 {
+			updated := store.GetLastUpdateTime()
+			if updated.IsZero() {
+				return math.Inf(1)
+			}
+			return time.Since(updated).Seconds()
+		})
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "token_expiry_seconds",
+			Help:        "Seconds until the access token expires; negative once expired.",
+			ConstLabels: labels,
+		}, func() float64 {
+			return time.Until(runtime.Token().ExpiresAt).Seconds()
+		})
 	}
 }
@@ -6,7 +6,7 @@ BEGIN
     END IF;
   ELSE
     EXECUTE 'CREATE TABLE instagram_tokens (
-      id BOOLEAN PRIMARY KEY DEFAULT TRUE,
+      account TEXT PRIMARY KEY DEFAULT ''default'',
       access_token TEXT NOT NULL,
       expires_at TIMESTAMPTZ NOT NULL,
       updated_at TIMESTAMPTZ DEFAULT now()
@@ -15,9 +15,44 @@ BEGIN
 END;
 $$ LANGUAGE plpgsql;
 
-INSERT INTO instagram_tokens (id, access_token, expires_at)
+INSERT INTO instagram_tokens (account, access_token, expires_at)
 VALUES (
-  TRUE,
+  'default',
   '<LONG_LIVED_ACCESS_TOKEN>',
   now() + interval '3 days'
-);
\ No newline at end of file
+);
+CREATE TABLE IF NOT EXISTS instagram_media (
+  account TEXT NOT NULL DEFAULT 'default',
+  id TEXT NOT NULL,
+  caption TEXT NOT NULL DEFAULT '',
+  media_type TEXT NOT NULL DEFAULT '',
+  media_url TEXT NOT NULL DEFAULT '',
+  thumbnail_url TEXT NOT NULL DEFAULT '',
+  permalink TEXT NOT NULL DEFAULT '',
+  posted_at TIMESTAMPTZ,
+  username TEXT NOT NULL DEFAULT '',
+  like_count INTEGER NOT NULL DEFAULT 0,
+  comments_count INTEGER NOT NULL DEFAULT 0,
+  is_shared_to_feed BOOLEAN NOT NULL DEFAULT FALSE,
+  children JSONB,
+  first_seen TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_seen TIMESTAMPTZ NOT NULL DEFAULT now(),
+  deleted_at TIMESTAMPTZ,
+  PRIMARY KEY (account, id)
+);
+
+CREATE INDEX IF NOT EXISTS instagram_media_active_idx
+  ON instagram_media (account, posted_at DESC)
+  WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS instagram_media_captions (
+  id BIGSERIAL PRIMARY KEY,
+  account TEXT NOT NULL DEFAULT 'default',
+  media_id TEXT NOT NULL,
+  caption TEXT NOT NULL,
+  recorded_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  FOREIGN KEY (account, media_id) REFERENCES instagram_media (account, id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS instagram_media_captions_media_idx
+  ON instagram_media_captions (account, media_id, recorded_at);
@@ -0,0 +1,42 @@
+-- Upgrades a single-account database, where instagram_tokens holds one row
+-- keyed by id BOOLEAN, to one token row and media archive per account.
+-- Existing rows become the "default" account. Safe to run more than once.
+
+DO $$
+BEGIN
+  IF EXISTS (
+    SELECT 1 FROM information_schema.columns
+    WHERE table_name = 'instagram_tokens' AND column_name = 'id'
+  ) THEN
+    ALTER TABLE instagram_tokens ADD COLUMN account TEXT NOT NULL DEFAULT 'default';
+    ALTER TABLE instagram_tokens DROP CONSTRAINT instagram_tokens_pkey;
+    ALTER TABLE instagram_tokens DROP COLUMN id;
+    ALTER TABLE instagram_tokens ADD PRIMARY KEY (account);
+  END IF;
+
+  IF NOT EXISTS (
+    SELECT 1 FROM information_schema.columns
+    WHERE table_name = 'instagram_media' AND column_name = 'account'
+  ) THEN
+    ALTER TABLE instagram_media_captions DROP CONSTRAINT instagram_media_captions_media_id_fkey;
+    ALTER TABLE instagram_media_captions ADD COLUMN account TEXT NOT NULL DEFAULT 'default';
+
+    ALTER TABLE instagram_media ADD COLUMN account TEXT NOT NULL DEFAULT 'default';
+    ALTER TABLE instagram_media DROP CONSTRAINT instagram_media_pkey;
+    ALTER TABLE instagram_media ADD PRIMARY KEY (account, id);
+
+    ALTER TABLE instagram_media_captions
+      ADD FOREIGN KEY (account, media_id) REFERENCES instagram_media (account, id) ON DELETE CASCADE;
+
+    DROP INDEX IF EXISTS instagram_media_active_idx;
+    DROP INDEX IF EXISTS instagram_media_captions_media_idx;
+  END IF;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE INDEX IF NOT EXISTS instagram_media_active_idx
+  ON instagram_media (account, posted_at DESC)
+  WHERE deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS instagram_media_captions_media_idx
+  ON instagram_media_captions (account, media_id, recorded_at);
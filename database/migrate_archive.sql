@@ -0,0 +1,45 @@
+-- Adds the media archive tables to a database created before the archive
+-- existed. Run it before migrate_accounts.sql, which upgrades these tables
+-- to one set of rows per account. Safe to run more than once.
+
+CREATE TABLE IF NOT EXISTS instagram_media (
+  id TEXT PRIMARY KEY,
+  caption TEXT NOT NULL DEFAULT '',
+  media_type TEXT NOT NULL DEFAULT '',
+  media_url TEXT NOT NULL DEFAULT '',
+  thumbnail_url TEXT NOT NULL DEFAULT '',
+  permalink TEXT NOT NULL DEFAULT '',
+  posted_at TIMESTAMPTZ,
+  username TEXT NOT NULL DEFAULT '',
+  like_count INTEGER NOT NULL DEFAULT 0,
+  comments_count INTEGER NOT NULL DEFAULT 0,
+  is_shared_to_feed BOOLEAN NOT NULL DEFAULT FALSE,
+  children JSONB,
+  first_seen TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_seen TIMESTAMPTZ NOT NULL DEFAULT now(),
+  deleted_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS instagram_media_captions (
+  id BIGSERIAL PRIMARY KEY,
+  media_id TEXT NOT NULL REFERENCES instagram_media (id) ON DELETE CASCADE,
+  caption TEXT NOT NULL,
+  recorded_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Databases already upgraded to multiple accounts index by account instead
+DO $$
+BEGIN
+  IF NOT EXISTS (
+    SELECT 1 FROM information_schema.columns
+    WHERE table_name = 'instagram_media' AND column_name = 'account'
+  ) THEN
+    CREATE INDEX IF NOT EXISTS instagram_media_active_idx
+      ON instagram_media (posted_at DESC)
+      WHERE deleted_at IS NULL;
+
+    CREATE INDEX IF NOT EXISTS instagram_media_captions_media_idx
+      ON instagram_media_captions (media_id, recorded_at);
+  END IF;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,240 @@
+package archive
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"backend-service/internal/instagram"
+
+	"github.com/lib/pq"
+)
+
+// timestampLayout is the format the Graph API uses for media timestamps
+const timestampLayout = "2006-01-02T15:04:05-0700"
+
+// Repository archives one account's media in PostgreSQL so posts survive
+// deletion on Instagram and can be served when Instagram and Redis are both
+// unavailable.
+type Repository struct {
+	db      *sql.DB
+	account string
+}
+
+func NewRepository(db *sql.DB, account string) *Repository {
+	return &Repository{db: db, account: account}
+}
+
+// Upsert records media as seen now in one statement. New items get
+// first_seen, items that were marked deleted are revived, and new captions
+// and caption changes are appended to the caption history.
+func (r *Repository) Upsert(media []instagram.Media) error {
+	media = latestByID(media)
+	if len(media) == 0 {
+		return nil
+	}
+
+	// Each column is passed as an array and unnested back into rows
+	n := len(media)
+	var (
+		ids        = make([]string, n)
+		captions   = make([]string, n)
+		types      = make([]string, n)
+		urls       = make([]string, n)
+		thumbnails = make([]string, n)
+		permalinks = make([]string, n)
+		postedAt   = make([]string, n)
+		usernames  = make([]string, n)
+		likes      = make([]int64, n)
+		comments   = make([]int64, n)
+		shared     = make([]bool, n)
+		children   = make([]string, n)
+	)
+	for i, m := range media {
+		data, err := json.Marshal(m.Children)
+		if err != nil {
+			return err
+		}
+		ids[i] = m.ID
+		captions[i] = m.Caption
+		types[i] = m.MediaType
+		urls[i] = m.MediaURL
+		thumbnails[i] = m.ThumbnailURL
+		permalinks[i] = m.Permalink
+		if t := parseTimestamp(m.Timestamp); t.Valid {
+			postedAt[i] = t.Time.Format(time.RFC3339)
+		}
+		usernames[i] = m.Username
+		likes[i] = int64(m.LikeCount)
+		comments[i] = int64(m.CommentsCount)
+		shared[i] = m.IsSharedToFeed
+		children[i] = string(data)
+	}
+
+	// previous reads the captions as they were before this statement, so the
+	// history gets a row for every new item and every changed caption
+	_, err := r.db.Exec(`
+		WITH incoming AS (
+			SELECT * FROM unnest(
+				$2::text[], $3::text[], $4::text[], $5::text[], $6::text[], $7::text[],
+				$8::text[], $9::text[], $10::bigint[], $11::bigint[], $12::boolean[], $13::text[]
+			) AS t(id, caption, media_type, media_url, thumbnail_url, permalink,
+				posted_at, username, like_count, comments_count, is_shared_to_feed, children)
+		),
+		previous AS (
+			SELECT id, caption FROM instagram_media WHERE account = $1 AND id = ANY($2::text[])
+		),
+		upserted AS (
+			INSERT INTO instagram_media (
+				account, id, caption, media_type, media_url, thumbnail_url, permalink,
+				posted_at, username, like_count, comments_count, is_shared_to_feed, children
+			)
+			SELECT $1, id, caption, media_type, media_url, thumbnail_url, permalink,
+				NULLIF(posted_at, '')::timestamptz, username, like_count, comments_count,
+				is_shared_to_feed, children::jsonb
+			FROM incoming
+			ON CONFLICT (account, id)
+			DO UPDATE SET
+				caption = EXCLUDED.caption,
+				media_type = EXCLUDED.media_type,
+				media_url = EXCLUDED.media_url,
+				thumbnail_url = EXCLUDED.thumbnail_url,
+				permalink = EXCLUDED.permalink,
+				posted_at = EXCLUDED.posted_at,
+				username = EXCLUDED.username,
+				like_count = EXCLUDED.like_count,
+				comments_count = EXCLUDED.comments_count,
+				is_shared_to_feed = EXCLUDED.is_shared_to_feed,
+				children = EXCLUDED.children,
+				last_seen = now(),
+				deleted_at = NULL
+			RETURNING id, caption
+		)
+		INSERT INTO instagram_media_captions (account, media_id, caption)
+		SELECT $1, u.id, u.caption
+		FROM upserted u
+		LEFT JOIN previous p ON p.id = u.id
+		WHERE p.id IS NULL OR p.caption IS DISTINCT FROM u.caption
+	`, r.account, pq.Array(ids), pq.Array(captions), pq.Array(types), pq.Array(urls),
+		pq.Array(thumbnails), pq.Array(permalinks), pq.Array(postedAt), pq.Array(usernames),
+		pq.Array(likes), pq.Array(comments), pq.Array(shared), pq.Array(children))
+	return err
+}
+
+// latestByID drops all but the last occurrence of each ID, since one
+// INSERT ... ON CONFLICT cannot update the same row twice
+func latestByID(media []instagram.Media) []instagram.Media {
+	last := make(map[string]int, len(media))
+	for i, m := range media {
+		last[m.ID] = i
+	}
+	if len(last) == len(media) {
+		return media
+	}
+	out := make([]instagram.Media, 0, len(last))
+	for i, m := range media {
+		if last[m.ID] == i {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// MarkDeleted stamps deleted_at on media that disappeared from Instagram.
+// Rows are kept so their history remains available.
+func (r *Repository) MarkDeleted(ids []string) error {
+	_, err := r.db.Exec(`
+		UPDATE instagram_media
+		SET deleted_at = now()
+		WHERE account = $1 AND id = ANY($2) AND deleted_at IS NULL
+	`, r.account, pq.Array(ids))
+	return err
+}
+
+// LoadActive returns every archived media item that has not been deleted,
+// along with the most recent time any of them was seen on Instagram.
+func (r *Repository) LoadActive() ([]instagram.Media, time.Time, error) {
+	rows, err := r.db.Query(`
+		SELECT id, caption, media_type, media_url, thumbnail_url, permalink,
+			posted_at, username, like_count, comments_count, is_shared_to_feed,
+			children, last_seen
+		FROM instagram_media
+		WHERE account = $1 AND deleted_at IS NULL
+	`, r.account)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer rows.Close()
+
+	var (
+		media    []instagram.Media
+		lastSeen time.Time
+	)
+	for rows.Next() {
+		var (
+			m        instagram.Media
+			postedAt sql.NullTime
+			children []byte
+			seen     time.Time
+		)
+		err := rows.Scan(&m.ID, &m.Caption, &m.MediaType, &m.MediaURL, &m.ThumbnailURL,
+			&m.Permalink, &postedAt, &m.Username, &m.LikeCount, &m.CommentsCount,
+			&m.IsSharedToFeed, &children, &seen)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+
+		if postedAt.Valid {
+			m.Timestamp = postedAt.Time.UTC().Format(timestampLayout)
+		}
+		if len(children) > 0 {
+			if err := json.Unmarshal(children, &m.Children); err != nil {
+				return nil, time.Time{}, err
+			}
+		}
+		if seen.After(lastSeen) {
+			lastSeen = seen
+		}
+		media = append(media, m)
+	}
+
+	return media, lastSeen, rows.Err()
+}
+
+// CaptionHistory is a caption as it read at a point in time
+type CaptionHistory struct {
+	Caption    string    `json:"caption"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// GetCaptionHistory returns every recorded caption for a media item, oldest first
+func (r *Repository) GetCaptionHistory(id string) ([]CaptionHistory, error) {
+	rows, err := r.db.Query(`
+		SELECT caption, recorded_at
+		FROM instagram_media_captions
+		WHERE account = $1 AND media_id = $2
+		ORDER BY recorded_at, id
+	`, r.account, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []CaptionHistory
+	for rows.Next() {
+		var h CaptionHistory
+		if err := rows.Scan(&h.Caption, &h.RecordedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, h)
+	}
+	return history, rows.Err()
+}
+
+func parseTimestamp(ts string) sql.NullTime {
+	t, err := time.Parse(timestampLayout, ts)
+	if err != nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t, Valid: true}
+}
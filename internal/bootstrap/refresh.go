@@ -0,0 +1,361 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"backend-service/internal/instagram"
+	"backend-service/internal/logging"
+	"backend-service/internal/token"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var refreshLog = logging.Component("token_refresh")
+
+var refreshOutcomes = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "token_refresh_total",
+	Help: "Token refresh checks by outcome: success, failure, skipped (token still valid) or in_progress (another instance holds the lease).",
+}, []string{"outcome"})
+
+// DefaultRefreshWindow is how long before expiry the token is refreshed
+const DefaultRefreshWindow = 7 * 24 * time.Hour
+
+// defaultLeaseTTL is the refresh lease TTL for a client without a timeout
+const defaultLeaseTTL = 5 * time.Minute
+
+// LeaseTTL is how long the refresh lease must last for a refresh through
+// client. The client timeout bounds the token exchange including its retries
+// and usage pacing; the lease is held twice as long to cover reading and
+// writing the token sources around it.
+func LeaseTTL(client *http.Client) time.Duration {
+	if client == nil || client.Timeout <= 0 {
+		return defaultLeaseTTL
+	}
+	return 2 * client.Timeout
+}
+
+// criticalWindow is how close to expiry a token that still has not been
+// refreshed is treated as critical
+const criticalWindow = 24 * time.Hour
+
+// Token health states, from best to worst
+const (
+	TokenHealthy  = "ok"
+	TokenWarning  = "warning"
+	TokenCritical = "critical"
+	TokenExpired  = "expired"
+)
+
+// TokenHealth summarizes the token's expiry and the refresher's recent outcomes
+type TokenHealth struct {
+	State               string    `json:"state"`
+	ExpiresAt           time.Time `json:"expires_at"`
+	LastRefresh         time.Time `json:"last_refresh,omitempty"`
+	LastAttempt         time.Time `json:"last_attempt,omitempty"`
+	LastError           string    `json:"last_error,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	Attempts            int64     `json:"attempts"`
+	Failures            int64     `json:"failures"`
+}
+
+// Refresher keeps the runtime token fresh. When Lock is set, only the
+// instance holding the Redis lease exchanges the token with Instagram; the
+// others pick up the result from the shared sources.
+type Refresher struct {
+	Runtime  *token.TokenRuntime
+	Chain    token.Chain
+	Client   *http.Client
+	Provider instagram.Provider
+	Lock     *token.RedisLock
+
+	// Window is how long before expiry to refresh; zero means DefaultRefreshWindow
+	Window time.Duration
+
+	mu                  sync.Mutex
+	lastRefresh         time.Time
+	lastAttempt         time.Time
+	lastErr             error
+	consecutiveFailures int
+	attempts            int64
+	failures            int64
+}
+
+func (r *Refresher) window() time.Duration {
+	if r.Window == 0 {
+		return DefaultRefreshWindow
+	}
+	return r.Window
+}
+
+// NextRefresh returns when the current token enters the refresh window
+func (r *Refresher) NextRefresh() time.Time {
+	return r.Runtime.Token().ExpiresAt.Add(-r.window())
+}
+
+// ErrRefreshInProgress is returned by ForceRefresh and Install when another
+// instance holds the refresh lease
+var ErrRefreshInProgress = errors.New("another instance is refreshing the token")
+
+// ErrInvalidToken is returned by Install for tokens that cannot be used
+var ErrInvalidToken = errors.New("invalid token")
+
+// Refresh first adopts a newer token from any source, in case another
+// instance already refreshed it, then exchanges the token with Instagram when
+// it is within the refresh window and writes the result to every source.
+func (r *Refresher) Refresh() error {
+	return r.refresh(false)
+}
+
+// ForceRefresh exchanges the token with Instagram now, regardless of expiry
+func (r *Refresher) ForceRefresh() error {
+	return r.refresh(true)
+}
+
+// errNoToken is recorded while there is no token to refresh, until one is
+// installed or another instance writes one
+var errNoToken = errors.New("no access token to refresh")
+
+func (r *Refresher) refresh(force bool) error {
+	r.adoptFreshest()
+	if r.Runtime.Get() == "" {
+		return r.recordFailure(errNoToken)
+	}
+
+	if !force && !r.Runtime.NeedsRefresh(r.window()) {
+		refreshLog.Info("access token is still valid, no need to refresh")
+		refreshOutcomes.WithLabelValues("skipped").Inc()
+		return nil
+	}
+
+	lease, err := r.acquire()
+	if err != nil {
+		return r.recordFailure(err)
+	}
+	if r.Lock != nil && lease == nil {
+		refreshLog.Info("another instance is refreshing the token")
+		refreshOutcomes.WithLabelValues("in_progress").Inc()
+		if force {
+			return ErrRefreshInProgress
+		}
+		return nil
+	}
+	if lease != nil {
+		defer lease.Release()
+
+		// The previous holder may have finished just before we got the lease
+		r.adoptFreshest()
+		if !force && !r.Runtime.NeedsRefresh(r.window()) {
+			refreshOutcomes.WithLabelValues("skipped").Inc()
+			return nil
+		}
+	}
+
+	r.mu.Lock()
+	r.attempts++
+	r.lastAttempt = time.Now()
+	r.mu.Unlock()
+
+	newToken, err := r.Provider.Refresh(context.Background(), r.Client, r.Runtime.Get())
+	if err != nil {
+		return r.recordFailure(err)
+	}
+
+	logSaveErrors(refreshLog, r.store(newToken, "instagram", lease))
+
+	r.mu.Lock()
+	r.lastRefresh = time.Now()
+	r.lastErr = nil
+	r.consecutiveFailures = 0
+	r.mu.Unlock()
+
+	refreshOutcomes.WithLabelValues("success").Inc()
+	refreshLog.Info("refreshed access token", "expires_at", newToken.ExpiresAt)
+	return nil
+}
+
+// Install replaces the token with one obtained outside the service, such as
+// a newly generated long-lived token, and writes it to every source. Source
+// failures are returned as joined *token.SourceError values.
+func (r *Refresher) Install(t token.Token) error {
+	if t.AccessToken == "" {
+		return fmt.Errorf("%w: access token is required", ErrInvalidToken)
+	}
+	if !t.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("%w: token is already expired", ErrInvalidToken)
+	}
+
+	lease, err := r.acquire()
+	if err != nil {
+		return err
+	}
+	if r.Lock != nil && lease == nil {
+		return ErrRefreshInProgress
+	}
+	if lease != nil {
+		defer lease.Release()
+	}
+
+	if err := r.store(t, "admin", lease); err != nil {
+		refreshLog.Warn("installed new access token but failed to save it to every source", "expires_at", t.ExpiresAt, logging.Err(err))
+		return err
+	}
+	refreshLog.Info("installed new access token", "expires_at", t.ExpiresAt)
+	return nil
+}
+
+// acquire takes the refresh lease when a lock is configured. A nil lease
+// with a nil error means another instance holds it.
+func (r *Refresher) acquire() (*token.Lease, error) {
+	if r.Lock == nil {
+		return nil, nil
+	}
+	lease, err := r.Lock.Acquire()
+	if err != nil {
+		return nil, fmt.Errorf("acquire refresh lease: %w", err)
+	}
+	return lease, nil
+}
+
+// store makes t the runtime token and writes it to every source. With a
+// lease, Redis is written through the lease's fence so a lapsed holder
+// cannot clobber a newer token. Disk and Postgres cannot check the fence
+// themselves, so they are skipped once Redis rejects the write as fenced;
+// a newer holder granted between the Redis write and theirs can still be
+// overwritten there, and the freshest token wins on the next adoption.
+func (r *Refresher) store(t token.Token, source string, lease *token.Lease) error {
+	r.Runtime.SetFrom(t, source)
+
+	if lease == nil {
+		return r.Chain.SaveAll(t)
+	}
+
+	var errs []error
+	if err := lease.Save(t); err != nil {
+		if errors.Is(err, token.ErrFenced) {
+			refreshLog.Warn("refresh lease lapsed before the token was stored, leaving it to the newer holder", "fence", lease.Fence)
+			return &token.SourceError{Source: "redis", Err: err}
+		}
+		errs = append(errs, &token.SourceError{Source: "redis", Err: err})
+	}
+	if err := r.Chain.Without("redis").SaveAll(t); err != nil {
+		errs = append(errs, err.(interface{ Unwrap() []error }).Unwrap()...)
+	}
+	return errors.Join(errs...)
+}
+
+// Persist writes the current token to every source that is missing it or
+// holds an older one, so a token refreshed while a source was unreachable is
+// not lost on shutdown. Nothing is written while another instance holds the
+// refresh lease, since it is about to write a newer token itself.
+func (r *Refresher) Persist() error {
+	current := r.Runtime.Token()
+	if current.AccessToken == "" {
+		return nil
+	}
+
+	lease, err := r.acquire()
+	if err != nil {
+		return err
+	}
+	if r.Lock != nil && lease == nil {
+		return ErrRefreshInProgress
+	}
+	if lease != nil {
+		defer lease.Release()
+	}
+
+	var (
+		behind token.Chain
+		errs   []error
+	)
+	for i, res := range r.Chain.LoadAll() {
+		if res.Err == nil && res.Token != nil && !res.Token.ExpiresAt.Before(current.ExpiresAt) {
+			continue
+		}
+		if lease != nil && res.Source == "redis" {
+			if err := lease.Save(current); err != nil {
+				errs = append(errs, &token.SourceError{Source: "redis", Err: err})
+			}
+			continue
+		}
+		behind = append(behind, r.Chain[i])
+	}
+	if err := behind.SaveAll(current); err != nil {
+		errs = append(errs, err.(interface{ Unwrap() []error }).Unwrap()...)
+	}
+	return errors.Join(errs...)
+}
+
+// Health reports the token's state. A token inside the refresh window is a
+// warning once a refresh has failed, critical within a day of expiry, and
+// expired after that.
+func (r *Refresher) Health() TokenHealth {
+	t := r.Runtime.Token()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	h := TokenHealth{
+		ExpiresAt:           t.ExpiresAt,
+		LastRefresh:         r.lastRefresh,
+		LastAttempt:         r.lastAttempt,
+		ConsecutiveFailures: r.consecutiveFailures,
+		Attempts:            r.attempts,
+		Failures:            r.failures,
+	}
+	if r.lastErr != nil {
+		h.LastError = logging.Redact(r.lastErr.Error())
+	}
+
+	remaining := time.Until(t.ExpiresAt)
+	switch {
+	case t.AccessToken == "" || remaining <= 0:
+		h.State = TokenExpired
+	case remaining < criticalWindow:
+		h.State = TokenCritical
+	case remaining < r.window() && r.consecutiveFailures > 0:
+		h.State = TokenWarning
+	default:
+		h.State = TokenHealthy
+	}
+	return h
+}
+
+func (r *Refresher) recordFailure(err error) error {
+	refreshOutcomes.WithLabelValues("failure").Inc()
+
+	r.mu.Lock()
+	r.failures++
+	r.consecutiveFailures++
+	r.lastErr = err
+	failures := r.consecutiveFailures
+	r.mu.Unlock()
+
+	h := r.Health()
+	level := slog.LevelWarn
+	if h.State == TokenCritical || h.State == TokenExpired {
+		level = slog.LevelError
+	}
+	refreshLog.Log(context.Background(), level, "token refresh failed",
+		"state", h.State,
+		"consecutive_failures", failures,
+		"expires_in", time.Until(h.ExpiresAt).Round(time.Minute).String(),
+		logging.Err(err),
+	)
+	return err
+}
+
+func (r *Refresher) adoptFreshest() {
+	best, ok := token.Freshest(r.Chain.LoadAll())
+	if ok && best.Token.ExpiresAt.After(r.Runtime.Token().ExpiresAt) {
+		refreshLog.Info("picked up newer token", "source", best.Source)
+		r.Runtime.SetFrom(*best.Token, best.Source)
+	}
+}
@@ -0,0 +1,142 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"backend-service/internal/instagram"
+	"backend-service/internal/token"
+)
+
+func TestRefresherHealthEscalatesTowardsExpiry(t *testing.T) {
+	cases := []struct {
+		name      string
+		expiresIn time.Duration
+		failed    bool
+		want      string
+	}{
+		{"outside window", 30 * 24 * time.Hour, false, TokenHealthy},
+		{"in window, no failures", 3 * 24 * time.Hour, false, TokenHealthy},
+		{"in window after failure", 3 * 24 * time.Hour, true, TokenWarning},
+		{"last day", 2 * time.Hour, false, TokenCritical},
+		{"expired", -time.Hour, false, TokenExpired},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rt := token.NewRuntime()
+			rt.Set(token.Token{AccessToken: "TOKEN", ExpiresAt: time.Now().Add(tc.expiresIn)})
+
+			r := &Refresher{Runtime: rt}
+			if tc.failed {
+				r.recordFailure(errors.New("graph api down"))
+			}
+
+			if got := r.Health().State; got != tc.want {
+				t.Fatalf("expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRefresherNextRefreshUsesWindow(t *testing.T) {
+	expiry := time.Now().Add(60 * 24 * time.Hour)
+	rt := token.NewRuntime()
+	rt.Set(token.Token{AccessToken: "TOKEN", ExpiresAt: expiry})
+
+	r := &Refresher{Runtime: rt, Window: 48 * time.Hour}
+	if got := r.NextRefresh(); !got.Equal(expiry.Add(-48 * time.Hour)) {
+		t.Fatalf("expected refresh 48h before expiry, got %v", got)
+	}
+}
+
+func TestLeaseTTLOutlastsTheRefreshClient(t *testing.T) {
+	client := &http.Client{Timeout: time.Minute}
+	if got := LeaseTTL(client); got <= client.Timeout {
+		t.Fatalf("expected the lease to outlast the %v client timeout, got %v", client.Timeout, got)
+	}
+	if got := LeaseTTL(&http.Client{}); got != defaultLeaseTTL {
+		t.Fatalf("expected %v for a client without a timeout, got %v", defaultLeaseTTL, got)
+	}
+}
+
+func TestPersistOnlyWritesSourcesThatAreBehind(t *testing.T) {
+	dir := t.TempDir()
+	behind := token.NewDiskSource(filepath.Join(dir, "behind.json"))
+	ahead := token.NewDiskSource(filepath.Join(dir, "ahead.json"))
+	missing := token.NewDiskSource(filepath.Join(dir, "missing.json"))
+
+	current := token.Token{AccessToken: "CURRENT", ExpiresAt: time.Now().Add(30 * 24 * time.Hour).Truncate(time.Second)}
+	newer := token.Token{AccessToken: "NEWER", ExpiresAt: current.ExpiresAt.Add(time.Hour)}
+	if err := behind.Save(token.Token{AccessToken: "OLD", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ahead.Save(newer); err != nil {
+		t.Fatal(err)
+	}
+
+	rt := token.NewRuntime()
+	rt.Set(current)
+	r := &Refresher{Runtime: rt, Chain: token.Chain{behind, ahead, missing}}
+	if err := r.Persist(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tc := range map[string]struct {
+		src  token.Source
+		want string
+	}{
+		"behind":  {behind, "CURRENT"},
+		"missing": {missing, "CURRENT"},
+		"ahead":   {ahead, "NEWER"},
+	} {
+		got, err := tc.src.Load()
+		if err != nil || got.AccessToken != tc.want {
+			t.Errorf("%s: expected %s, got %v, %v", name, tc.want, got, err)
+		}
+	}
+}
+
+func TestRefreshWithoutTokenFailsUntilOneIsInstalled(t *testing.T) {
+	r := &Refresher{Runtime: token.NewRuntime()}
+	if err := r.Refresh(); !errors.Is(err, errNoToken) {
+		t.Fatalf("expected errNoToken, got %v", err)
+	}
+	if h := r.Health(); h.State != TokenExpired || h.ConsecutiveFailures != 1 {
+		t.Fatalf("expected an expired token with one failure, got %+v", h)
+	}
+
+	if err := r.Install(token.Token{AccessToken: "INSTALLED", ExpiresAt: time.Now().Add(60 * 24 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Refresh(); err != nil {
+		t.Fatalf("expected the installed token to need no refresh, got %v", err)
+	}
+	if h := r.Health(); h.State != TokenHealthy {
+		t.Fatalf("expected a healthy token after install, got %+v", h)
+	}
+}
+
+func TestInitTokenRefreshStopsWhenCancelled(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	chain := token.Chain{token.NewDiskSource(filepath.Join(t.TempDir(), "token.json"))}
+	provider := instagram.App{BaseURL: srv.URL, ID: "app", Secret: "secret"}
+	err := InitToken(ctx, token.NewRuntime(), chain, srv.Client(), provider)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the refresh to stop with the context, got %v", err)
+	}
+}
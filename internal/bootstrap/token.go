@@ -1,67 +1,102 @@
 package bootstrap
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
-	"time"
 
 	"backend-service/internal/instagram"
+	"backend-service/internal/logging"
 	"backend-service/internal/token"
-
-	"github.com/redis/go-redis/v9"
 )
 
+var logger = logging.Component("bootstrap")
+
+// InitToken loads the freshest valid token across every source in the chain,
+// writes it back to sources that are missing, behind, or still hold it in
+// plaintext or under a rotated-out key, and falls back to a refresh against
+// Instagram when no source holds a valid token. Cancelling ctx abandons that
+// refresh.
 func InitToken(
+	ctx context.Context,
 	runtime *token.TokenRuntime,
-	redisClient *redis.Client,
+	chain token.Chain,
 	client *http.Client,
-	tokenPath string,
+	provider instagram.Provider,
 ) error {
 
-	// 1. Try disk
-	if t, err := token.LoadFromDisk(tokenPath); err == nil {
-		if time.Now().Before(t.ExpiresAt) {
-			runtime.Set(*t)
-			return nil
-		} else {
-			log.Printf("[BOOTSTRAP] Token from disk is expired - %v", t.ExpiresAt)
+	// 1. Read every source
+	results := chain.LoadAll()
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			logger.Warn("no token found", "source", r.Source, logging.Err(r.Err))
+		case r.Token != nil:
+			logger.Info("loaded token", "source", r.Source, "expires_at", r.Token.ExpiresAt)
 		}
-	} else {
-		log.Printf("[BOOTSTRAP] No token found on disk: %v", err)
 	}
 
-	// 2. Try Redis
-	if t, err := token.LoadFromRedis(redisClient); err == nil {
-		if time.Now().Before(t.ExpiresAt) {
-			runtime.Set(*t)
-			token.SaveToDisk(tokenPath, t)
-			return nil
-		} else {
-			log.Printf("[BOOTSTRAP] Token from Redis is expired - %v", t.ExpiresAt)
+	// 2. Use the freshest valid token and bring the other sources up to date
+	if best, ok := token.Freshest(results); ok {
+		logger.Info("using freshest token", "source", best.Source)
+		runtime.SetFrom(*best.Token, best.Source)
+
+		var stale token.Chain
+		for i, r := range results {
+			if r.Err != nil || r.Token == nil || r.Token.NeedsMigration() || !sameToken(*r.Token, *best.Token) {
+				stale = append(stale, chain[i])
+			}
 		}
-	} else {
-		log.Printf("[BOOTSTRAP] No token found in Redis: %v", err)
+		logSaveErrors(logger, stale.SaveAll(*best.Token))
+		return nil
 	}
 
-	// 3. Refresh from Instagram
-	log.Println("[BOOTSTRAP] Refreshing token from Instagram...")
-	newInstagramToken, err := instagram.RefreshAccessToken(client, runtime.Get())
+	// 3. Refresh from Instagram, starting from the most recent token we have
+	logger.Info("no valid token found, refreshing from Instagram")
+	if latest := latestToken(results); latest != nil {
+		runtime.Set(*latest)
+	}
+	newToken, err := provider.Refresh(ctx, client, runtime.Get())
 	if err != nil {
 		return err
 	}
 
-	// Map instagram.Token to token.Token
-	newToken := token.Token{
-		AccessToken: newInstagramToken.AccessToken,
-		ExpiresAt:   newInstagramToken.ExpiresAt,
-		// Add other fields as necessary
-	}
-
-	log.Printf("[BOOTSTRAP] New token expires at: %v", newToken.ExpiresAt)
-	log.Println("[BOOTSTRAP] Storing new token...")
-	runtime.Set(newToken)
-	token.SaveToDisk(tokenPath, &newToken)
-	token.SaveToRedis(redisClient, newToken)
+	logger.Info("refreshed token from Instagram", "expires_at", newToken.ExpiresAt)
+	runtime.SetFrom(newToken, "instagram")
+	logSaveErrors(logger, chain.SaveAll(newToken))
 
 	return nil
 }
+
+func sameToken(a, b token.Token) bool {
+	return a.AccessToken == b.AccessToken && a.ExpiresAt.Equal(b.ExpiresAt)
+}
+
+// latestToken returns the loaded token with the latest expiry, even if it
+// has already expired
+func latestToken(results []token.LoadResult) *token.Token {
+	var latest *token.Token
+	for _, r := range results {
+		if r.Err != nil || r.Token == nil || r.Token.AccessToken == "" {
+			continue
+		}
+		if latest == nil || r.Token.ExpiresAt.After(latest.ExpiresAt) {
+			latest = r.Token
+		}
+	}
+	return latest
+}
+
+// logSaveErrors reports each source that failed to persist the token
+func logSaveErrors(log *slog.Logger, err error) {
+	if err == nil {
+		return
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			log.Error("failed to save token", logging.Err(e))
+		}
+		return
+	}
+	log.Error("failed to save token", logging.Err(err))
+}
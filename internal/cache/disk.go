@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// DiskSnapshot persists media snapshots as JSON at Path. It is used when the
+// service runs without Redis, so a restart on the same host still starts warm.
+type DiskSnapshot struct {
+	Path string
+}
+
+func NewDiskSnapshot(path string) *DiskSnapshot {
+	return &DiskSnapshot{Path: path}
+}
+
+// Save writes the snapshot to a temporary file and renames it over Path, so
+// a crash mid-write never leaves a truncated snapshot
+func (d *DiskSnapshot) Save(snap Snapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(d.Path), filepath.Base(d.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), d.Path)
+}
+
+func (d *DiskSnapshot) Load() (Snapshot, error) {
+	data, err := os.ReadFile(d.Path)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	var snap Snapshot
+	err = json.Unmarshal(data, &snap)
+	return snap, err
+}
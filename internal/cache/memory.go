@@ -1,41 +1,166 @@
 package cache
 
 import (
-	"log"
 	"sort"
 	"sync"
 	"time"
 
 	"backend-service/internal/instagram"
+	"backend-service/internal/logging"
 )
 
+var logger = logging.Component("cache")
+
 type Store struct {
 	mu        sync.RWMutex
 	media     map[string]instagram.Media
+	index     *searchIndex
 	updatedAt time.Time
+
+	persistMu sync.Mutex
+	persister Persister
 }
 
 func NewStore() *Store {
 	return &Store{
 		media: make(map[string]instagram.Media),
+		index: newSearchIndex(),
 	}
 }
 
 func (s *Store) SetMedia(list []instagram.Media) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
 	for _, media := range list {
-		s.media[media.ID] = media
+		s.media[media.ID] = s.keepPlaceholderLocked(media)
+		s.index.add(media)
 	}
 	s.updatedAt = time.Now()
-	log.Printf("[CACHE] Updated %d media items at %v", len(list), s.updatedAt.Format(time.RFC3339))
+	change := Change{Upserted: list, UpdatedAt: s.updatedAt}
+	logger.Info("updated media", "count", len(list), "updated_at", s.updatedAt)
+	s.mu.Unlock()
+
+	s.persist(change)
+}
+
+// ReplaceMedia makes list the complete contents of the cache, dropping any
+// cached media that is not in it. It returns the IDs that were removed.
+func (s *Store) ReplaceMedia(list []instagram.Media) []string {
+	s.mu.Lock()
+
+	next := make(map[string]instagram.Media, len(list))
+	for _, media := range list {
+		next[media.ID] = s.keepPlaceholderLocked(media)
+	}
+
+	removed := []string{}
+	for id := range s.media {
+		if _, ok := next[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+
+	s.media = next
+	s.index.reset()
+	for _, media := range next {
+		s.index.add(media)
+	}
+	s.updatedAt = time.Now()
+	change := Change{Upserted: list, Deleted: removed, UpdatedAt: s.updatedAt}
+	logger.Info("replaced media", "count", len(list), "removed", len(removed))
+	s.mu.Unlock()
+
+	s.persist(change)
+	return removed
+}
+
+// keepPlaceholderLocked carries the cached placeholder over to a refetched
+// item. Instagram never changes the image behind a media ID, so it stays valid.
+func (s *Store) keepPlaceholderLocked(media instagram.Media) instagram.Media {
+	if media.Placeholder == (instagram.Placeholder{}) {
+		media.Placeholder = s.media[media.ID].Placeholder
+	}
+	return media
+}
+
+// SetPlaceholders stores computed placeholders on cached media. IDs that are
+// no longer cached are ignored.
+func (s *Store) SetPlaceholders(placeholders map[string]instagram.Placeholder) {
+	s.mu.Lock()
+	var updated []instagram.Media
+	for id, p := range placeholders {
+		if media, ok := s.media[id]; ok {
+			media.Placeholder = p
+			s.media[id] = media
+			updated = append(updated, media)
+		}
+	}
+	change := Change{Upserted: updated, UpdatedAt: s.updatedAt}
+	s.mu.Unlock()
+
+	if len(updated) > 0 {
+		logger.Info("updated media placeholders", "count", len(updated))
+		s.persist(change)
+	}
+}
+
+// MissingPlaceholders returns cached media that has an image but no
+// placeholder yet
+func (s *Store) MissingPlaceholders() []instagram.Media {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []instagram.Media
+	for _, media := range s.media {
+		if media.Placeholder == (instagram.Placeholder{}) && media.ImageURL() != "" {
+			out = append(out, media)
+		}
+	}
+	return out
+}
+
+// Len returns the number of cached media items
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.media)
+}
+
+// Newest returns the most recent cached media item by timestamp
+func (s *Store) Newest() (instagram.Media, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var newest instagram.Media
+	found := false
+	for _, media := range s.media {
+		if !found || media.Timestamp > newest.Timestamp {
+			newest = media
+			found = true
+		}
+	}
+	return newest, found
+}
+
+// DeleteMedia removes the given media IDs from the cache
+func (s *Store) DeleteMedia(ids ...string) {
+	s.mu.Lock()
+	for _, id := range ids {
+		delete(s.media, id)
+		s.index.remove(id)
+	}
+	s.updatedAt = time.Now()
+	change := Change{Deleted: ids, UpdatedAt: s.updatedAt}
+	logger.Info("deleted media", "count", len(ids))
+	s.mu.Unlock()
+
+	s.persist(change)
 }
 
 func (s *Store) GetByIDs(ids []string) []instagram.Media {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	log.Printf("Fetching media by IDs: %v", ids)
+	logger.Debug("fetching media by IDs", "ids", ids)
 
 	result := make([]instagram.Media, 0, len(ids))
 	for _, id := range ids {
@@ -61,19 +186,7 @@ func (s *Store) GetAllMediaIDs(limit int, mediaType string) []string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	// Collect media that matches the filter
-	filtered := make([]instagram.Media, 0, len(s.media))
-	for _, media := range s.media {
-		if mediaType != "" && media.MediaType != mediaType {
-			continue
-		}
-		filtered = append(filtered, media)
-	}
-
-	// Sort by timestamp descending (latest first)
-	sort.Slice(filtered, func(i, j int) bool {
-		return filtered[i].Timestamp > filtered[j].Timestamp
-	})
+	filtered := s.queryLocked(Query{MediaType: mediaType})
 
 	// Extract IDs with limit
 	result := make([]string, 0, len(filtered))
@@ -86,10 +199,73 @@ func (s *Store) GetAllMediaIDs(limit int, mediaType string) []string {
 	return result
 }
 
+// GetMediaPage returns up to limit media items matching q in q's sort order,
+// starting after the given cursor. An empty cursor starts from the first item.
+// The returned cursor is empty when there are no more items.
+func (s *Store) GetMediaPage(q Query, limit int, cursor string) ([]instagram.Media, string, error) {
+	var after cursorPos
+	if cursor != "" {
+		var err error
+		after, err = decodeCursor(cursor, q.sortKey())
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sorted := s.queryLocked(q)
+
+	start := 0
+	if cursor != "" {
+		start = sort.Search(len(sorted), func(i int) bool {
+			return after.before(q.sortValue(sorted[i]), sorted[i].ID)
+		})
+	}
+
+	end := len(sorted)
+	if limit > 0 && start+limit < end {
+		end = start + limit
+	}
+
+	page := sorted[start:end]
+	next := ""
+	if end < len(sorted) && len(page) > 0 {
+		last := page[len(page)-1]
+		next = encodeCursor(q.sortKey(), q.sortValue(last), last.ID)
+	}
+	return page, next, nil
+}
+
+// queryLocked returns media matching q in q's sort order, with ID as a
+// tie-breaker. Callers must hold s.mu.
+func (s *Store) queryLocked(q Query) []instagram.Media {
+	// Collect media that matches the filter
+	filtered := make([]instagram.Media, 0, len(s.media))
+	for _, media := range s.media {
+		if !q.matches(media) {
+			continue
+		}
+		filtered = append(filtered, media)
+	}
+
+	// Sort descending by the requested key (latest first by default)
+	sort.Slice(filtered, func(i, j int) bool {
+		vi, vj := q.sortValue(filtered[i]), q.sortValue(filtered[j])
+		if vi != vj {
+			return vi > vj
+		}
+		return filtered[i].ID > filtered[j].ID
+	})
+	return filtered
+}
+
 func (s *Store) Clear() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.media = make(map[string]instagram.Media)
+	s.index.reset()
 	s.updatedAt = time.Time{}
 }
 
@@ -40,3 +40,102 @@ func TestConcurrentMediaAccess(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestGetMediaPage(t *testing.T) {
+	store := NewStore()
+	store.SetMedia([]instagram.Media{
+		{ID: "1", Timestamp: "2026-01-01T00:00:00+0000"},
+		{ID: "2", Timestamp: "2026-01-02T00:00:00+0000"},
+		{ID: "3", Timestamp: "2026-01-03T00:00:00+0000"},
+		{ID: "4", Timestamp: "2026-01-03T00:00:00+0000"},
+		{ID: "5", Timestamp: "2026-01-04T00:00:00+0000"},
+	})
+
+	var got []string
+	cursor := ""
+	for {
+		page, next, err := store.GetMediaPage(Query{}, 2, cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range page {
+			got = append(got, m.ID)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	want := []string{"5", "4", "3", "2", "1"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestGetMediaPageInvalidCursor(t *testing.T) {
+	store := NewStore()
+
+	if _, _, err := store.GetMediaPage(Query{}, 10, "not a cursor"); err != ErrInvalidCursor {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestGetMediaPageFilterAndSort(t *testing.T) {
+	store := NewStore()
+	store.SetMedia([]instagram.Media{
+		{ID: "1", MediaType: "IMAGE", LikeCount: 10},
+		{ID: "2", MediaType: "VIDEO", LikeCount: 50},
+		{ID: "3", MediaType: "IMAGE", LikeCount: 30},
+		{ID: "4", MediaType: "IMAGE", LikeCount: 5},
+	})
+
+	q := Query{MediaType: "IMAGE", MinLikes: 6, SortBy: SortLikes}
+	page, next, err := store.GetMediaPage(q, 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 1 || page[0].ID != "3" {
+		t.Fatalf("expected media 3 first, got %v", page)
+	}
+
+	page, next, err = store.GetMediaPage(q, 1, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 1 || page[0].ID != "1" || next != "" {
+		t.Fatalf("expected media 1 as last page, got %v (next %q)", page, next)
+	}
+
+	// A cursor issued for one sort order is rejected for another
+	_, cursor, _ := store.GetMediaPage(q, 1, "")
+	if _, _, err := store.GetMediaPage(Query{}, 1, cursor); err != ErrInvalidCursor {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestRefetchKeepsPlaceholder(t *testing.T) {
+	store := NewStore()
+	store.SetMedia([]instagram.Media{{ID: "1", MediaURL: "https://cdn/old.jpg"}})
+	store.SetPlaceholders(map[string]instagram.Placeholder{"1": {Width: 1080, Height: 1350, BlurHash: "LKO2?U%2Tw=w"}})
+
+	if missing := store.MissingPlaceholders(); len(missing) != 0 {
+		t.Fatalf("expected no media missing a placeholder, got %v", missing)
+	}
+
+	// A sync brings the item back with a re-signed URL and no placeholder
+	store.ReplaceMedia([]instagram.Media{{ID: "1", MediaURL: "https://cdn/new.jpg"}, {ID: "2", MediaURL: "https://cdn/2.jpg"}})
+
+	got := store.GetByIDs([]string{"1"})[0]
+	if got.Width != 1080 || got.MediaURL != "https://cdn/new.jpg" {
+		t.Fatalf("expected the new URL with the old placeholder, got %+v", got)
+	}
+	if missing := store.MissingPlaceholders(); len(missing) != 1 || missing[0].ID != "2" {
+		t.Fatalf("expected only media 2 to miss a placeholder, got %v", missing)
+	}
+}
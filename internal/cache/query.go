@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"backend-service/internal/instagram"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Sort orders supported by Query. All orders are descending.
+const (
+	SortTimestamp = "timestamp"
+	SortLikes     = "like_count"
+	SortComments  = "comments_count"
+)
+
+// Query filters and orders media in the store. The zero value matches
+// everything, newest first.
+type Query struct {
+	MediaType    string
+	Username     string
+	MinLikes     int
+	MinComments  int
+	SharedToFeed *bool
+	SortBy       string
+}
+
+// ValidSort reports whether sortBy is a supported sort order
+func ValidSort(sortBy string) bool {
+	switch sortBy {
+	case "", SortTimestamp, SortLikes, SortComments:
+		return true
+	}
+	return false
+}
+
+func (q Query) matches(m instagram.Media) bool {
+	if q.MediaType != "" && m.MediaType != q.MediaType {
+		return false
+	}
+	if q.Username != "" && !strings.EqualFold(m.Username, q.Username) {
+		return false
+	}
+	if m.LikeCount < q.MinLikes || m.CommentsCount < q.MinComments {
+		return false
+	}
+	if q.SharedToFeed != nil && m.IsSharedToFeed != *q.SharedToFeed {
+		return false
+	}
+	return true
+}
+
+func (q Query) sortKey() string {
+	if q.SortBy == "" {
+		return SortTimestamp
+	}
+	return q.SortBy
+}
+
+// sortValue returns a string for m that orders lexically in the same way as
+// the sort key, so counts are zero-padded.
+func (q Query) sortValue(m instagram.Media) string {
+	switch q.sortKey() {
+	case SortLikes:
+		return fmt.Sprintf("%020d", m.LikeCount)
+	case SortComments:
+		return fmt.Sprintf("%020d", m.CommentsCount)
+	default:
+		return m.Timestamp
+	}
+}
+
+// cursorPos is the position of the last item on a page
+type cursorPos struct {
+	value string
+	id    string
+}
+
+// before reports whether the cursor sorts before an item with the given
+// sort value and ID, i.e. whether that item belongs on a later page.
+func (c cursorPos) before(value, id string) bool {
+	if value != c.value {
+		return value < c.value
+	}
+	return id < c.id
+}
+
+func encodeCursor(sortKey, value, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(sortKey + "|" + value + "|" + id))
+}
+
+func decodeCursor(cursor, sortKey string) (cursorPos, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return cursorPos{}, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), "|", 3)
+	if len(parts) != 3 || parts[0] != sortKey || parts[2] == "" {
+		return cursorPos{}, ErrInvalidCursor
+	}
+	return cursorPos{value: parts[1], id: parts[2]}, nil
+}
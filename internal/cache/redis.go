@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+
+	"backend-service/internal/logging"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var ctx = context.Background()
+
+// RedisSnapshot persists media snapshots to a Redis key and announces each
+// change on a pub/sub channel so other replicas can apply it to their cache.
+type RedisSnapshot struct {
+	client     redis.UniversalClient
+	key        string
+	channel    string
+	instanceID string
+}
+
+// changeMessage is a Change as published on the update channel
+type changeMessage struct {
+	Instance string `json:"instance"`
+	Change
+}
+
+// NewRedisSnapshot stores snapshots under key, with change notifications on
+// key + ":updates"
+func NewRedisSnapshot(client redis.UniversalClient, key string) *RedisSnapshot {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	return &RedisSnapshot{
+		client:     client,
+		key:        key,
+		channel:    key + ":updates",
+		instanceID: hex.EncodeToString(id),
+	}
+}
+
+// Save writes the snapshot a restarted instance loads
+func (r *RedisSnapshot) Save(snap Snapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, r.key, data, 0).Err()
+}
+
+// Publish announces c, tagged with this instance's ID, on the update channel
+func (r *RedisSnapshot) Publish(c Change) error {
+	data, err := json.Marshal(changeMessage{Instance: r.instanceID, Change: c})
+	if err != nil {
+		return err
+	}
+	return r.client.Publish(ctx, r.channel, data).Err()
+}
+
+func (r *RedisSnapshot) Load() (Snapshot, error) {
+	val, err := r.client.Get(ctx, r.key).Bytes()
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	var snap Snapshot
+	err = json.Unmarshal(val, &snap)
+	return snap, err
+}
+
+// Subscribe applies the changes other instances publish to store, item by
+// item, so concurrent writes on different replicas do not undo each other.
+// Instances that only announce their ID reload the snapshot, which replaces
+// store only when it is newer. It returns when ctx is cancelled.
+func (r *RedisSnapshot) Subscribe(ctx context.Context, store *Store) {
+	sub := r.client.Subscribe(ctx, r.channel)
+	defer sub.Close()
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+
+			var change changeMessage
+			if err := json.Unmarshal([]byte(msg.Payload), &change); err == nil {
+				if change.Instance != r.instanceID {
+					store.Apply(change.Change)
+				}
+				continue
+			}
+			if msg.Payload == r.instanceID {
+				continue
+			}
+
+			snap, err := r.Load()
+			if err != nil {
+				logger.Error("failed to reload media snapshot after update", "instance", msg.Payload, logging.Err(err))
+				continue
+			}
+			if snap.UpdatedAt.After(store.GetLastUpdateTime()) {
+				store.Restore(snap)
+			}
+		}
+	}
+}
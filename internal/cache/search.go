@@ -0,0 +1,342 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"backend-service/internal/instagram"
+)
+
+// Search orders. Relevance ties fall back to recency.
+const (
+	SortRelevance = "relevance"
+	SortRecent    = "recent"
+)
+
+// ErrEmptySearch is returned for a search with neither text nor a tag
+var ErrEmptySearch = errors.New("search needs q or tag")
+
+// SearchQuery selects media by caption text and hashtag. Text words match
+// caption words, hashtags and mentions by prefix, so "diab" finds "diabetes";
+// a word written as #tag or @user only matches hashtags or mentions. Tag is
+// an exact hashtag, with or without the #. Every word and the tag must match.
+type SearchQuery struct {
+	Text   string
+	Tag    string
+	SortBy string
+}
+
+// ValidSearchSort reports whether sortBy is a supported search order
+func ValidSearchSort(sortBy string) bool {
+	switch sortBy {
+	case "", SortRelevance, SortRecent:
+		return true
+	}
+	return false
+}
+
+// sortKey defaults to relevance when there is text to rank by
+func (q SearchQuery) sortKey() string {
+	if q.SortBy != "" {
+		return q.SortBy
+	}
+	if q.Text != "" {
+		return SortRelevance
+	}
+	return SortRecent
+}
+
+// Term kinds in the index. Hashtags and mentions are also indexed as plain
+// words so a text search finds them without the # or @.
+const (
+	kindWord    = ""
+	kindTag     = "#"
+	kindMention = "@"
+)
+
+// searchIndex is an inverted index over captions. Terms are stored with
+// their kind prefix ("#fasting", "@clinic", "fasting") in a sorted slice for
+// prefix lookups. Callers hold the Store's lock.
+type searchIndex struct {
+	postings map[string]map[string]int // term -> media ID -> occurrences
+	terms    []string                  // sorted keys of postings
+	docs     map[string]map[string]int // media ID -> term -> occurrences
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		postings: make(map[string]map[string]int),
+		docs:     make(map[string]map[string]int),
+	}
+}
+
+// add indexes media, replacing what was indexed for its ID before
+func (x *searchIndex) add(media instagram.Media) {
+	x.remove(media.ID)
+
+	terms := make(map[string]int)
+	for _, t := range tokenize(media.Caption) {
+		terms[t]++
+	}
+	if len(terms) == 0 {
+		return
+	}
+	x.docs[media.ID] = terms
+
+	for t, n := range terms {
+		p, ok := x.postings[t]
+		if !ok {
+			p = make(map[string]int)
+			x.postings[t] = p
+			i := sort.SearchStrings(x.terms, t)
+			x.terms = append(x.terms, "")
+			copy(x.terms[i+1:], x.terms[i:])
+			x.terms[i] = t
+		}
+		p[media.ID] = n
+	}
+}
+
+func (x *searchIndex) remove(id string) {
+	for t := range x.docs[id] {
+		p := x.postings[t]
+		delete(p, id)
+		if len(p) == 0 {
+			delete(x.postings, t)
+			i := sort.SearchStrings(x.terms, t)
+			x.terms = append(x.terms[:i], x.terms[i+1:]...)
+		}
+	}
+	delete(x.docs, id)
+}
+
+func (x *searchIndex) reset() {
+	*x = *newSearchIndex()
+}
+
+// score returns the media IDs matching every word of q, scored by how often
+// the matched terms occur in each caption, halved for prefix rather than
+// whole-term matches. Scores depend only on the caption itself and not on
+// the rest of the index, so a relevance cursor stays valid as media is added
+// or removed.
+func (x *searchIndex) score(q SearchQuery) map[string]float64 {
+	var scores map[string]float64
+
+	match := func(term string, prefix bool) {
+		matched := make(map[string]float64)
+		lo := sort.SearchStrings(x.terms, term)
+		for i := lo; i < len(x.terms) && strings.HasPrefix(x.terms[i], term); i++ {
+			t := x.terms[i]
+			if !prefix && t != term {
+				break
+			}
+			weight := 1.0
+			if t != term {
+				weight = 0.5
+			}
+			for id, n := range x.postings[t] {
+				matched[id] += weight * float64(n)
+			}
+		}
+
+		if scores == nil {
+			scores = matched
+			return
+		}
+		for id := range scores {
+			if s, ok := matched[id]; ok {
+				scores[id] += s
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	if tag := normalizeTag(q.Tag); tag != "" {
+		match(kindTag+tag, false)
+	}
+	for _, t := range queryTerms(q.Text) {
+		match(t, true)
+	}
+	return scores
+}
+
+// tokenize returns the indexed terms of a caption: every word, plus each
+// hashtag and mention with its kind prefix
+func tokenize(text string) []string {
+	var out []string
+	for _, w := range words(text) {
+		out = append(out, w.text)
+		if w.kind != kindWord {
+			out = append(out, w.kind+w.text)
+		}
+	}
+	return out
+}
+
+// queryTerms tokenizes search text, keeping a # or @ only as a filter on kind
+func queryTerms(text string) []string {
+	var out []string
+	for _, w := range words(text) {
+		out = append(out, w.kind+w.text)
+	}
+	return out
+}
+
+type word struct {
+	kind string
+	text string
+}
+
+// words splits text into lowercase words. A # or @ starts a hashtag or
+// mention, also in the middle of a run like "#keto#fasting". Dots and
+// underscores inside a word are kept so handles like @dr.smith stay whole.
+func words(text string) []word {
+	var out []word
+	for _, field := range strings.FieldsFunc(strings.ToLower(text), isSeparator) {
+		for len(field) > 0 {
+			kind := kindWord
+			if field[0] == '#' || field[0] == '@' {
+				kind, field = field[:1], field[1:]
+			}
+			end := strings.IndexAny(field, "#@")
+			if end < 0 {
+				end = len(field)
+			}
+			text := strings.TrimFunc(field[:end], func(r rune) bool {
+				return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+			})
+			if text != "" {
+				out = append(out, word{kind, text})
+			}
+			field = field[end:]
+		}
+	}
+	return out
+}
+
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("#@._", r)
+}
+
+// searchPos is a result's place in search order: highest score first when
+// ranking by relevance, then newest first, then by descending ID
+type searchPos struct {
+	score     float64
+	timestamp string
+	id        string
+}
+
+// after reports whether p comes after o in search order
+func (p searchPos) after(o searchPos) bool {
+	if p.score != o.score {
+		return p.score < o.score
+	}
+	if p.timestamp != o.timestamp {
+		return p.timestamp < o.timestamp
+	}
+	return p.id < o.id
+}
+
+// cursorValue is the sort value stored in a search cursor: the timestamp,
+// preceded by the score when ranking by relevance
+func (p searchPos) cursorValue(byRelevance bool) string {
+	if !byRelevance {
+		return p.timestamp
+	}
+	return strconv.FormatFloat(p.score, 'g', -1, 64) + "," + p.timestamp
+}
+
+func parseSearchCursor(cursor, sortKey string, byRelevance bool) (searchPos, error) {
+	c, err := decodeCursor(cursor, sortKey)
+	if err != nil {
+		return searchPos{}, err
+	}
+	pos := searchPos{timestamp: c.value, id: c.id}
+	if byRelevance {
+		score, timestamp, ok := strings.Cut(c.value, ",")
+		if !ok {
+			return searchPos{}, ErrInvalidCursor
+		}
+		if pos.score, err = strconv.ParseFloat(score, 64); err != nil {
+			return searchPos{}, ErrInvalidCursor
+		}
+		pos.timestamp = timestamp
+	}
+	return pos, nil
+}
+
+// Search returns up to limit media items matching q, best first, starting
+// after cursor. The cursor holds the sort position of the last item served,
+// so pages stay consistent while other media is added or removed; an item
+// whose caption changes between pages can move across the cursor. The returned
+// cursor is empty when there are no more items.
+func (s *Store) Search(q SearchQuery, limit int, cursor string) ([]instagram.Media, string, error) {
+	if strings.TrimSpace(q.Text) == "" && normalizeTag(q.Tag) == "" {
+		return nil, "", ErrEmptySearch
+	}
+	if !ValidSearchSort(q.SortBy) {
+		return nil, "", fmt.Errorf("sort must be %s or %s", SortRelevance, SortRecent)
+	}
+
+	sortKey := "search:" + q.sortKey()
+	byRelevance := q.sortKey() == SortRelevance
+	var from *searchPos
+	if cursor != "" {
+		pos, err := parseSearchCursor(cursor, sortKey, byRelevance)
+		if err != nil {
+			return nil, "", err
+		}
+		from = &pos
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	type result struct {
+		media instagram.Media
+		pos   searchPos
+	}
+	scores := s.index.score(q)
+	results := make([]result, 0, len(scores))
+	for id, score := range scores {
+		media, ok := s.media[id]
+		if !ok {
+			continue
+		}
+		pos := searchPos{timestamp: media.Timestamp, id: id}
+		if byRelevance {
+			pos.score = score
+		}
+		results = append(results, result{media, pos})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[j].pos.after(results[i].pos) })
+
+	start := 0
+	if from != nil {
+		start = sort.Search(len(results), func(i int) bool { return results[i].pos.after(*from) })
+	}
+	end := len(results)
+	if limit > 0 && start+limit < end {
+		end = start + limit
+	}
+
+	page := make([]instagram.Media, 0, end-start)
+	for _, r := range results[start:end] {
+		page = append(page, r.media)
+	}
+	next := ""
+	if end < len(results) && end > start {
+		last := results[end-1].pos
+		next = encodeCursor(sortKey, last.cursorValue(byRelevance), last.id)
+	}
+	return page, next, nil
+}
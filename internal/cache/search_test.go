@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"backend-service/internal/instagram"
+)
+
+func searchStore() *Store {
+	store := NewStore()
+	store.SetMedia([]instagram.Media{
+		{ID: "1", Timestamp: "2026-01-01", Caption: "Diabetes and fasting: what the research says #IntermittentFasting #health"},
+		{ID: "2", Timestamp: "2026-01-02", Caption: "Patient story with @dr.smith #intermittentfasting#keto"},
+		{ID: "3", Timestamp: "2026-01-03", Caption: "Type 2 diabetes, diabetes again, diabetic recipes"},
+		{ID: "4", Timestamp: "2026-01-04", Caption: "Nothing to see here"},
+	})
+	return store
+}
+
+func ids(media []instagram.Media) []string {
+	out := make([]string, len(media))
+	for i, m := range media {
+		out[i] = m.ID
+	}
+	return out
+}
+
+func TestSearch(t *testing.T) {
+	store := searchStore()
+
+	tests := []struct {
+		name string
+		q    SearchQuery
+		want []string
+	}{
+		{"tag is exact and case-insensitive, newest first", SearchQuery{Tag: "#intermittentfasting"}, []string{"2", "1"}},
+		{"concatenated hashtags are split", SearchQuery{Tag: "keto"}, []string{"2"}},
+		{"more occurrences rank higher", SearchQuery{Text: "diabetes"}, []string{"3", "1"}},
+		{"prefix match", SearchQuery{Text: "diab", SortBy: SortRecent}, []string{"3", "1"}},
+		{"every word must match", SearchQuery{Text: "diabetes fasting"}, []string{"1"}},
+		{"mention", SearchQuery{Text: "@dr.smith"}, []string{"2"}},
+		{"hashtag words are searchable without #", SearchQuery{Text: "intermittent"}, []string{"2", "1"}},
+		{"text and tag combine", SearchQuery{Text: "patient", Tag: "keto"}, []string{"2"}},
+		{"a # in q only matches hashtags", SearchQuery{Text: "#diabetes"}, []string{}},
+	}
+	for _, tt := range tests {
+		got, _, err := store.Search(tt.q, 0, "")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(ids(got), tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, ids(got))
+		}
+	}
+
+	if _, _, err := store.Search(SearchQuery{}, 0, ""); !errors.Is(err, ErrEmptySearch) {
+		t.Fatalf("expected ErrEmptySearch, got %v", err)
+	}
+}
+
+func TestSearchIndexFollowsChanges(t *testing.T) {
+	store := searchStore()
+
+	store.SetMedia([]instagram.Media{{ID: "3", Timestamp: "2026-01-03", Caption: "Now about sleep"}})
+	store.DeleteMedia("1")
+
+	if got, _, _ := store.Search(SearchQuery{Text: "diabetes"}, 0, ""); len(got) != 0 {
+		t.Fatalf("expected edited and deleted captions to drop out, got %v", ids(got))
+	}
+	if got, _, _ := store.Search(SearchQuery{Text: "sleep"}, 0, ""); !reflect.DeepEqual(ids(got), []string{"3"}) {
+		t.Fatalf("expected the edited caption to be found, got %v", ids(got))
+	}
+
+	store.ReplaceMedia([]instagram.Media{{ID: "5", Caption: "#keto"}})
+	if got, _, _ := store.Search(SearchQuery{Tag: "keto"}, 0, ""); !reflect.DeepEqual(ids(got), []string{"5"}) {
+		t.Fatalf("expected only the replacement media, got %v", ids(got))
+	}
+}
+
+func TestSearchPages(t *testing.T) {
+	store := searchStore()
+	q := SearchQuery{Tag: "intermittentfasting"}
+
+	page, next, err := store.Search(q, 1, "")
+	if err != nil || !reflect.DeepEqual(ids(page), []string{"2"}) || next == "" {
+		t.Fatalf("unexpected first page %v, %q, %v", ids(page), next, err)
+	}
+	// A new post ahead of the cursor does not shift the next page
+	store.SetMedia([]instagram.Media{{ID: "9", Timestamp: "2026-02-01", Caption: "#intermittentfasting"}})
+	page, next, err = store.Search(q, 1, next)
+	if err != nil || !reflect.DeepEqual(ids(page), []string{"1"}) || next != "" {
+		t.Fatalf("unexpected last page %v, %q, %v", ids(page), next, err)
+	}
+
+	// Relevance pages resume after the last score, then timestamp and ID
+	q = SearchQuery{Text: "diabetes"}
+	var all []string
+	for cursor := ""; ; {
+		page, cursor, err = store.Search(q, 1, cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, ids(page)...)
+		if cursor == "" {
+			break
+		}
+	}
+	if !reflect.DeepEqual(all, []string{"3", "1"}) {
+		t.Fatalf("expected relevance pages 3 then 1, got %v", all)
+	}
+
+	// Media added between relevance pages does not change the scores of the
+	// rest, so the next page neither repeats nor skips an item
+	page, next, err = store.Search(q, 1, "")
+	if err != nil || !reflect.DeepEqual(ids(page), []string{"3"}) {
+		t.Fatalf("unexpected first relevance page %v, %v", ids(page), err)
+	}
+	store.SetMedia([]instagram.Media{{ID: "10", Timestamp: "2026-02-02", Caption: "diabetes diabetes diabetes"}})
+	page, next, err = store.Search(q, 1, next)
+	if err != nil || !reflect.DeepEqual(ids(page), []string{"1"}) || next != "" {
+		t.Fatalf("expected relevance page 1 after adding media, got %v, %q, %v", ids(page), next, err)
+	}
+
+	if _, _, err := store.Search(SearchQuery{Tag: "keto", SortBy: SortRelevance}, 1, "bogus"); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"time"
+
+	"backend-service/internal/instagram"
+	"backend-service/internal/logging"
+)
+
+// Snapshot is the full contents of a Store at a point in time
+type Snapshot struct {
+	Media     []instagram.Media `json:"media"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// Change is one modification of a Store: media that was added or refetched
+// and IDs that were removed
+type Change struct {
+	Upserted  []instagram.Media `json:"upserted,omitempty"`
+	Deleted   []string          `json:"deleted,omitempty"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// Persister saves a Store's contents after every change so a restarted
+// instance can start warm
+type Persister interface {
+	Save(snap Snapshot) error
+}
+
+// ChangePublisher is a Persister that also announces each change, so other
+// replicas can apply it to their own store item by item instead of
+// replacing their contents with a snapshot that may miss their own writes
+type ChangePublisher interface {
+	Persister
+	Publish(c Change) error
+}
+
+// SnapshotStore is a Persister that can also load the last saved snapshot
+type SnapshotStore interface {
+	Persister
+	Load() (Snapshot, error)
+}
+
+// SetPersister registers p to receive a snapshot after every change to the store
+func (s *Store) SetPersister(p Persister) {
+	s.persistMu.Lock()
+	defer s.persistMu.Unlock()
+	s.persister = p
+}
+
+// Snapshot returns a copy of the store's contents
+func (s *Store) Snapshot() Snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	media := make([]instagram.Media, 0, len(s.media))
+	for _, m := range s.media {
+		media = append(media, m)
+	}
+	return Snapshot{Media: media, UpdatedAt: s.updatedAt}
+}
+
+// Restore replaces the store's contents with snap, keeping its update time.
+// It does not notify the persister, since the snapshot came from it.
+func (s *Store) Restore(snap Snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.media = make(map[string]instagram.Media, len(snap.Media))
+	s.index.reset()
+	for _, m := range snap.Media {
+		s.media[m.ID] = m
+		s.index.add(m)
+	}
+	s.updatedAt = snap.UpdatedAt
+	logger.Info("restored media from snapshot", "count", len(snap.Media), "snapshot_at", snap.UpdatedAt)
+}
+
+// Apply makes a change published by another replica. Like Restore it does
+// not notify the persister. The update time only moves forward.
+func (s *Store) Apply(c Change) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, media := range c.Upserted {
+		s.media[media.ID] = s.keepPlaceholderLocked(media)
+		s.index.add(media)
+	}
+	for _, id := range c.Deleted {
+		delete(s.media, id)
+		s.index.remove(id)
+	}
+	if c.UpdatedAt.After(s.updatedAt) {
+		s.updatedAt = c.UpdatedAt
+	}
+	logger.Info("applied media change from another instance", "upserted", len(c.Upserted), "deleted", len(c.Deleted))
+}
+
+// persist hands the current contents to the persister, and the change to it
+// when it publishes changes. Saves are serialized so the last one written
+// always reflects the latest change.
+func (s *Store) persist(c Change) {
+	s.persistMu.Lock()
+	defer s.persistMu.Unlock()
+	if s.persister == nil {
+		return
+	}
+	if err := s.persister.Save(s.Snapshot()); err != nil {
+		logger.Error("failed to persist media snapshot", logging.Err(err))
+	}
+	if pub, ok := s.persister.(ChangePublisher); ok {
+		if err := pub.Publish(c); err != nil {
+			logger.Error("failed to publish media change", logging.Err(err))
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"path/filepath"
+	"testing"
+
+	"backend-service/internal/instagram"
+)
+
+type recordingPersister struct {
+	saved []Snapshot
+}
+
+func (p *recordingPersister) Save(snap Snapshot) error {
+	p.saved = append(p.saved, snap)
+	return nil
+}
+
+func TestStorePersistsAndRestoresSnapshot(t *testing.T) {
+	p := &recordingPersister{}
+	store := NewStore()
+	store.SetPersister(p)
+
+	store.SetMedia([]instagram.Media{{ID: "1"}, {ID: "2"}})
+	store.DeleteMedia("1")
+
+	if len(p.saved) != 2 {
+		t.Fatalf("expected 2 snapshots, got %d", len(p.saved))
+	}
+
+	last := p.saved[len(p.saved)-1]
+	if len(last.Media) != 1 || last.Media[0].ID != "2" {
+		t.Fatalf("expected snapshot with media 2, got %v", last.Media)
+	}
+
+	restored := NewStore()
+	restored.SetPersister(p)
+	restored.Restore(last)
+
+	if restored.Len() != 1 || !restored.GetLastUpdateTime().Equal(last.UpdatedAt) {
+		t.Fatal("restore did not reproduce snapshot contents")
+	}
+	if len(p.saved) != 2 {
+		t.Fatal("restore should not persist a new snapshot")
+	}
+}
+
+func TestDiskSnapshotRoundTrip(t *testing.T) {
+	disk := NewDiskSnapshot(filepath.Join(t.TempDir(), "media.json"))
+
+	store := NewStore()
+	store.SetPersister(disk)
+	store.SetMedia([]instagram.Media{{ID: "1"}, {ID: "2"}})
+
+	snap, err := disk.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Media) != 2 || !snap.UpdatedAt.Equal(store.GetLastUpdateTime()) {
+		t.Fatalf("unexpected snapshot: %+v", snap)
+	}
+}
+
+type recordingPublisher struct {
+	recordingPersister
+	changes []Change
+}
+
+func (p *recordingPublisher) Publish(c Change) error {
+	p.changes = append(p.changes, c)
+	return nil
+}
+
+func TestConcurrentChangesOnReplicasAreNotLost(t *testing.T) {
+	first, second := &recordingPublisher{}, &recordingPublisher{}
+	a, b := NewStore(), NewStore()
+	a.SetMedia([]instagram.Media{{ID: "1"}, {ID: "2"}})
+	b.SetMedia([]instagram.Media{{ID: "1"}, {ID: "2"}})
+	a.SetPersister(first)
+	b.SetPersister(second)
+
+	// An incremental sync on one replica and a webhook delete on the other
+	a.SetMedia([]instagram.Media{{ID: "3"}})
+	b.DeleteMedia("1")
+
+	for _, c := range second.changes {
+		a.Apply(c)
+	}
+	for _, c := range first.changes {
+		b.Apply(c)
+	}
+
+	for name, store := range map[string]*Store{"first": a, "second": b} {
+		if ok, missing := store.HasMedia([]string{"2", "3"}); !ok || store.Len() != 2 {
+			t.Fatalf("%s replica: expected media 2 and 3, missing %v, %d items", name, missing, store.Len())
+		}
+	}
+	if len(first.saved) != 1 || len(second.saved) != 1 {
+		t.Fatal("applying another replica's change should not persist a new snapshot")
+	}
+}
@@ -1,31 +1,452 @@
 package config
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend-service/internal/logging"
 
 	"github.com/joho/godotenv"
 )
 
+var logger = logging.Component("config")
+
+// DefaultAccount is the account built from IG_USER_ID when ACCOUNTS is not
+// set. It keeps the single-account Redis keys, files and Postgres row.
+const DefaultAccount = "default"
+
+// Account is one Instagram account served by the process
+type Account struct {
+	Name     string
+	IgUserID string
+}
+
 type Config struct {
 	Port     string
 	IgUserID string
+
+	// Accounts lists every account to serve, from ACCOUNTS entries of the
+	// form name=ig_user_id, or just the default account for IG_USER_ID
+	Accounts []Account
+
+	// LoginProvider is the login flow that issued the access token: facebook
+	// (fb_exchange_token) or instagram (ig_refresh_token)
+	LoginProvider string
+
+	// AppID and AppSecret identify the Meta app used to exchange tokens.
+	// They are required for the facebook provider.
+	AppID     string
+	AppSecret string
+
+	// FBAPIBaseURL is the Graph API root, including the version, without a
+	// trailing slash
+	FBAPIBaseURL string
+
+	// IGGraphAPIBaseURL is the unversioned graph.instagram.com root used by
+	// the instagram provider; media comes from IGGraphAPIVersion under it
+	IGGraphAPIBaseURL string
+	IGGraphAPIVersion string
+
+	WebhookVerifyToken string
+	AdminAPIKey        string
+
+	// RedisURL is a redis:// or rediss:// URL. Redis is optional; without it
+	// or the legacy Upstash settings the service runs on disk and Postgres
+	RedisURL            string
+	RedisPassword       string
+	RedisMode           string
+	RedisSentinelMaster string
+	RedisTokenKey       string
+	RedisMediaKey       string
+
+	// UpstashURL and UpstashToken are the legacy Upstash settings, used when
+	// RedisURL is not set
+	UpstashURL   string
+	UpstashToken string
+
+	// DatabaseURL is optional; without it the service runs on disk and Redis
+	DatabaseURL string
+
+	// MediaSyncInterval is how often the incremental media sync runs
+	MediaSyncInterval time.Duration
+
+	// MediaReconcileInterval is how often the media sync does a full fetch
+	// that also removes posts deleted on Instagram
+	MediaReconcileInterval time.Duration
+
+	// TokenSources is the order in which token sources are consulted
+	TokenSources []string
+
+	// TokenEncryptionKeys holds "id:base64key" entries; TokenEncryptionKeyFile
+	// is read instead when it is empty
+	TokenEncryptionKeys    string
+	TokenEncryptionKeyFile string
+
+	// ImageCacheDir holds resized media images, evicted least recently used
+	// once they pass ImageCacheSizeMB. An empty dir disables the cache.
+	ImageCacheDir    string
+	ImageCacheSizeMB int
+
+	// ShutdownTimeout bounds how long shutdown waits for in-flight requests
+	// and background jobs
+	ShutdownTimeout time.Duration
+
+	// LogLevel is the minimum level written to the log: debug, info, warn or error
+	LogLevel string
+}
+
+// setting describes one configuration value. Its environment variable is
+// key; in a config file it is the lowercase form of key.
+type setting struct {
+	key        string
+	def        string
+	secret     bool
+	deprecated bool
+	set        func(c *Config, v string) error
+	get        func(c Config) string
+}
+
+var settings = []setting{
+	str("PORT", "8000", false, func(c *Config) *string { return &c.Port }),
+	str("LOG_LEVEL", "info", false, func(c *Config) *string { return &c.LogLevel }),
+	duration("SHUTDOWN_TIMEOUT", "15", time.Second, func(c *Config) *time.Duration { return &c.ShutdownTimeout }),
+
+	str("IG_USER_ID", "", false, func(c *Config) *string { return &c.IgUserID }),
+	accounts("ACCOUNTS", func(c *Config) *[]Account { return &c.Accounts }),
+	str("LOGIN_PROVIDER", "facebook", false, func(c *Config) *string { return &c.LoginProvider }),
+	str("APP_ID", "", false, func(c *Config) *string { return &c.AppID }),
+	str("APP_SECRET", "", true, func(c *Config) *string { return &c.AppSecret }),
+	str("FB_API_BASE_URL", "https://graph.facebook.com/v24.0", false, func(c *Config) *string { return &c.FBAPIBaseURL }),
+	str("IG_GRAPH_API_BASE_URL", "https://graph.instagram.com", false, func(c *Config) *string { return &c.IGGraphAPIBaseURL }),
+	str("IG_GRAPH_API_VERSION", "v24.0", false, func(c *Config) *string { return &c.IGGraphAPIVersion }),
+	str("IG_WEBHOOK_VERIFY_TOKEN", "", true, func(c *Config) *string { return &c.WebhookVerifyToken }),
+	str("ADMIN_API_KEY", "", true, func(c *Config) *string { return &c.AdminAPIKey }),
+
+	str("REDIS_URL", "", true, func(c *Config) *string { return &c.RedisURL }),
+	str("REDIS_PASSWORD", "", true, func(c *Config) *string { return &c.RedisPassword }),
+	str("REDIS_MODE", RedisSingle, false, func(c *Config) *string { return &c.RedisMode }),
+	str("REDIS_SENTINEL_MASTER", "", false, func(c *Config) *string { return &c.RedisSentinelMaster }),
+	str("UPSTASH_REDIS_REST_URL", "", false, func(c *Config) *string { return &c.UpstashURL }),
+	str("UPSTASH_REDIS_REST_TOKEN", "", true, func(c *Config) *string { return &c.UpstashToken }),
+	str("REDIS_TOKEN_KEY", "instagram_token", false, func(c *Config) *string { return &c.RedisTokenKey }),
+	str("REDIS_MEDIA_KEY", "instagram_media", false, func(c *Config) *string { return &c.RedisMediaKey }),
+	str("DATABASE_URL", "", true, func(c *Config) *string { return &c.DatabaseURL }),
+
+	duration("MEDIA_SYNC_TIME", "45", time.Minute, func(c *Config) *time.Duration { return &c.MediaSyncInterval }),
+	duration("MEDIA_RECONCILE_TIME", "24", time.Hour, func(c *Config) *time.Duration { return &c.MediaReconcileInterval }),
+	deprecated("TOKEN_REFRESH_TIME", "the token is refreshed when it nears expiry"),
+	list("TOKEN_SOURCES", "disk,redis,postgres", func(c *Config) *[]string { return &c.TokenSources }),
+	str("TOKEN_ENCRYPTION_KEYS", "", true, func(c *Config) *string { return &c.TokenEncryptionKeys }),
+	str("TOKEN_ENCRYPTION_KEY_FILE", "", false, func(c *Config) *string { return &c.TokenEncryptionKeyFile }),
+
+	str("IMAGE_CACHE_DIR", "image_cache", false, func(c *Config) *string { return &c.ImageCacheDir }),
+	integer("IMAGE_CACHE_SIZE_MB", "512", func(c *Config) *int { return &c.ImageCacheSizeMB }),
 }
 
-func LoadConfig() Config {
-	// Load .env file
-	err := godotenv.Load()
-	if err != nil {
-		log.Println("No .env file found, using system env vars")
+// Load builds the configuration from defaults, then the optional config file
+// at path (a flat JSON or YAML mapping), then environment
+// variables and .env. Every invalid or missing value is reported in the
+// returned error; the Config is still filled in as far as possible so it can
+// be printed.
+func Load(path string) (Config, error) {
+	if err := godotenv.Load(); err != nil {
+		logger.Info("no .env file found, using system env vars")
+	}
+
+	values := make(map[string]string, len(settings))
+	for _, s := range settings {
+		values[s.key] = s.def
+	}
+
+	var errs []error
+	if path != "" {
+		file, err := readFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+		known := make(map[string]bool, len(settings))
+		for _, s := range settings {
+			known[s.key] = true
+		}
+		for k, v := range file {
+			key := strings.ToUpper(k)
+			if !known[key] {
+				errs = append(errs, fmt.Errorf("%s: unknown setting %q", path, k))
+				continue
+			}
+			values[key] = v
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.key); ok && v != "" {
+			values[s.key] = v
+		}
 	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8000" // default port
+	var cfg Config
+	for _, s := range settings {
+		v := strings.TrimSpace(values[s.key])
+		if v == "" {
+			continue
+		}
+		if err := s.set(&cfg, v); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.key, err))
+		}
+	}
+
+	errs = append(errs, cfg.validate()...)
+	return cfg, errors.Join(errs...)
+}
+
+// validate checks values that parse but are out of range
+func (c *Config) validate() []error {
+	var errs []error
+	if len(c.Accounts) == 0 {
+		if c.IgUserID == "" {
+			errs = append(errs, errors.New("IG_USER_ID is required"))
+		} else {
+			c.Accounts = []Account{{Name: DefaultAccount, IgUserID: c.IgUserID}}
+		}
+	}
+	if !logging.ValidLevel(c.LogLevel) {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL must be debug, info, warn or error, got %q", c.LogLevel))
 	}
+	if p, err := strconv.Atoi(c.Port); err != nil || p < 1 || p > 65535 {
+		errs = append(errs, fmt.Errorf("PORT must be a number between 1 and 65535, got %q", c.Port))
+	}
+
+	switch c.LoginProvider {
+	case "facebook":
+		if c.AppID == "" {
+			errs = append(errs, errors.New("APP_ID is required"))
+		}
+		if c.AppSecret == "" {
+			errs = append(errs, errors.New("APP_SECRET is required"))
+		}
+	case "instagram":
+		// Webhook payloads are signed with the app secret whatever the login
+		if c.WebhookVerifyToken != "" && c.AppSecret == "" {
+			errs = append(errs, errors.New("APP_SECRET is required with IG_WEBHOOK_VERIFY_TOKEN to verify webhook signatures"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("LOGIN_PROVIDER must be facebook or instagram, got %q", c.LoginProvider))
+	}
+
+	baseURLs := []struct {
+		key string
+		url *string
+	}{
+		{"FB_API_BASE_URL", &c.FBAPIBaseURL},
+		{"IG_GRAPH_API_BASE_URL", &c.IGGraphAPIBaseURL},
+	}
+	for _, b := range baseURLs {
+		*b.url = strings.TrimRight(*b.url, "/")
+		if u, err := url.Parse(*b.url); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("%s must be an absolute URL, got %q", b.key, *b.url))
+		}
+	}
+	c.IGGraphAPIVersion = strings.Trim(c.IGGraphAPIVersion, "/")
+
+	switch c.RedisMode {
+	case RedisSingle, RedisSentinel, RedisCluster:
+	default:
+		errs = append(errs, fmt.Errorf("REDIS_MODE must be single, sentinel or cluster, got %q", c.RedisMode))
+	}
+	if c.RedisURL != "" {
+		if u, err := url.Parse(c.RedisURL); err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") {
+			errs = append(errs, errors.New("REDIS_URL must be a redis:// or rediss:// URL"))
+		}
+	} else if c.UpstashURL != "" && c.UpstashToken == "" {
+		errs = append(errs, errors.New("UPSTASH_REDIS_REST_TOKEN is required with UPSTASH_REDIS_REST_URL"))
+	}
+
+	durations := []struct {
+		key string
+		d   time.Duration
+	}{
+		{"SHUTDOWN_TIMEOUT", c.ShutdownTimeout},
+		{"MEDIA_SYNC_TIME", c.MediaSyncInterval},
+		{"MEDIA_RECONCILE_TIME", c.MediaReconcileInterval},
+	}
+	for _, d := range durations {
+		if d.d <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", d.key))
+		}
+	}
+	if c.ImageCacheSizeMB <= 0 {
+		errs = append(errs, errors.New("IMAGE_CACHE_SIZE_MB must be positive"))
+	}
+	if len(c.TokenSources) == 0 {
+		errs = append(errs, errors.New("TOKEN_SOURCES must list at least one source"))
+	}
+	return errs
+}
+
+// Print writes the configuration as KEY=value lines with secrets masked
+func Print(w io.Writer, c Config) {
+	for _, s := range settings {
+		if s.deprecated {
+			continue
+		}
+		v := s.get(c)
+		if s.secret && v != "" {
+			v = "********"
+		}
+		fmt.Fprintf(w, "%s=%s\n", s.key, v)
+	}
+}
+
+// Secrets returns every configured secret value, so they can be redacted
+// from logs
+func Secrets(c Config) []string {
+	var out []string
+	for _, s := range settings {
+		if v := s.get(c); s.secret && v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func str(key, def string, secret bool, field func(*Config) *string) setting {
+	return setting{
+		key: key, def: def, secret: secret,
+		set: func(c *Config, v string) error { *field(c) = v; return nil },
+		get: func(c Config) string { return *field(&c) },
+	}
+}
+
+// duration accepts a Go duration such as "90m", or a bare number in unit
+// for compatibility with the original integer settings
+func duration(key, def string, unit time.Duration, field func(*Config) *time.Duration) setting {
+	return setting{
+		key: key, def: def,
+		set: func(c *Config, v string) error {
+			if n, err := strconv.Atoi(v); err == nil {
+				*field(c) = time.Duration(n) * unit
+				return nil
+			}
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("expected a number of %s or a duration like 90m, got %q", unitName(unit), v)
+			}
+			*field(c) = d
+			return nil
+		},
+		get: func(c Config) string { return field(&c).String() },
+	}
+}
+
+func integer(key, def string, field func(*Config) *int) setting {
+	return setting{
+		key: key, def: def,
+		set: func(c *Config, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("expected a whole number, got %q", v)
+			}
+			*field(c) = n
+			return nil
+		},
+		get: func(c Config) string { return strconv.Itoa(*field(&c)) },
+	}
+}
+
+func list(key, def string, field func(*Config) *[]string) setting {
+	return setting{
+		key: key, def: def,
+		set: func(c *Config, v string) error {
+			var items []string
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			*field(c) = items
+			return nil
+		},
+		get: func(c Config) string { return strings.Join(*field(&c), ",") },
+	}
+}
+
+// deprecated accepts a setting that no longer has any effect, so existing
+// environments and config files keep loading, and warns when it is set
+func deprecated(key, reason string) setting {
+	return setting{
+		key: key, deprecated: true,
+		set: func(c *Config, v string) error {
+			logger.Warn("ignoring deprecated setting", "key", key, "reason", reason)
+			return nil
+		},
+		get: func(c Config) string { return "" },
+	}
+}
+
+// accountName restricts names to what is safe in URLs, Redis keys and file names
+var accountName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// accounts parses name=ig_user_id entries
+func accounts(key string, field func(*Config) *[]Account) setting {
+	return setting{
+		key: key,
+		set: func(c *Config, v string) error {
+			var (
+				out     []Account
+				seen    = make(map[string]bool)
+				seenIDs = make(map[string]string)
+			)
+			for _, entry := range strings.Split(v, ",") {
+				if entry = strings.TrimSpace(entry); entry == "" {
+					continue
+				}
+				name, id, ok := strings.Cut(entry, "=")
+				name, id = strings.TrimSpace(name), strings.TrimSpace(id)
+				switch {
+				case !ok || id == "":
+					return fmt.Errorf("expected name=ig_user_id, got %q", entry)
+				case !accountName.MatchString(name):
+					return fmt.Errorf("account name %q must be lowercase letters, digits, - or _", name)
+				case seen[name]:
+					return fmt.Errorf("account %q is listed twice", name)
+				case seenIDs[id] != "":
+					// Webhook events are routed by IG user ID
+					return fmt.Errorf("accounts %q and %q have the same ig_user_id %s", seenIDs[id], name, id)
+				}
+				seen[name] = true
+				seenIDs[id] = name
+				out = append(out, Account{Name: name, IgUserID: id})
+			}
+			*field(c) = out
+			return nil
+		},
+		get: func(c Config) string {
+			entries := make([]string, len(*field(&c)))
+			for i, a := range *field(&c) {
+				entries[i] = a.Name + "=" + a.IgUserID
+			}
+			return strings.Join(entries, ",")
+		},
+	}
+}
 
-	return Config{
-		Port:     port,
-		IgUserID: os.Getenv("IG_USER_ID"),
+func unitName(unit time.Duration) string {
+	switch unit {
+	case time.Second:
+		return "seconds"
+	case time.Minute:
+		return "minutes"
+	case time.Hour:
+		return "hours"
+	case 24 * time.Hour:
+		return "days"
 	}
+	return unit.String()
 }
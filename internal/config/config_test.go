@@ -0,0 +1,259 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// clearEnv hides any settings from the surrounding environment
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, s := range settings {
+		t.Setenv(s.key, "")
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadReportsEveryError(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("MEDIA_SYNC_TIME", "soon")
+	t.Setenv("LOG_LEVEL", "loud")
+	t.Setenv("REDIS_MODE", "ring")
+	t.Setenv("UPSTASH_REDIS_REST_URL", "https://redis.example")
+	t.Setenv("IMAGE_CACHE_SIZE_MB", "lots")
+
+	_, err := Load("")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{
+		"IG_USER_ID is required",
+		"APP_ID is required",
+		"APP_SECRET is required",
+		"MEDIA_SYNC_TIME: expected a number of minutes",
+		"LOG_LEVEL must be",
+		"REDIS_MODE must be single, sentinel or cluster",
+		"UPSTASH_REDIS_REST_TOKEN is required with UPSTASH_REDIS_REST_URL",
+		"IMAGE_CACHE_SIZE_MB: expected a whole number",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoadLayersFileUnderEnv(t *testing.T) {
+	clearEnv(t)
+	path := writeFile(t, "config.yaml", `
+# service settings
+ig_user_id: "1784"
+app_id: app
+app_secret: 'shh # not a comment'
+upstash_redis_rest_url: https://redis.example
+upstash_redis_rest_token: redis-secret
+fb_api_base_url: https://graph.example/v24.0/
+media_sync_time: 90s
+token_sources: [redis, disk]
+port: 9000
+`)
+	t.Setenv("PORT", "8080")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Port != "8080" {
+		t.Errorf("expected env to override file, got port %s", cfg.Port)
+	}
+	if cfg.AppSecret != "shh # not a comment" || cfg.IgUserID != "1784" {
+		t.Errorf("unexpected values: %+v", cfg)
+	}
+	if cfg.FBAPIBaseURL != "https://graph.example/v24.0" {
+		t.Errorf("expected trailing slash trimmed, got %s", cfg.FBAPIBaseURL)
+	}
+	if cfg.MediaSyncInterval != 90*time.Second || cfg.MediaReconcileInterval != 24*time.Hour {
+		t.Errorf("unexpected intervals: %v, %v", cfg.MediaSyncInterval, cfg.MediaReconcileInterval)
+	}
+	if strings.Join(cfg.TokenSources, ",") != "redis,disk" {
+		t.Errorf("unexpected token sources: %v", cfg.TokenSources)
+	}
+}
+
+func TestLoadJSONAndPrintMasksSecrets(t *testing.T) {
+	clearEnv(t)
+	path := writeFile(t, "config.json", `{
+		"IG_USER_ID": "1784",
+		"APP_ID": "app",
+		"APP_SECRET": "app-secret",
+		"UPSTASH_REDIS_REST_URL": "https://redis.example",
+		"UPSTASH_REDIS_REST_TOKEN": "redis-secret",
+		"MEDIA_RECONCILE_TIME": 7,
+		"TOKEN_REFRESH_TIME": 30,
+		"TOKEN_SOURCES": ["disk"]
+	}`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MediaReconcileInterval != 7*time.Hour {
+		t.Errorf("expected 7 hours, got %v", cfg.MediaReconcileInterval)
+	}
+
+	var out strings.Builder
+	Print(&out, cfg)
+	if strings.Contains(out.String(), "app-secret") || strings.Contains(out.String(), "redis-secret") {
+		t.Fatalf("secrets leaked:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "APP_SECRET=********\n") || !strings.Contains(out.String(), "APP_ID=app\n") {
+		t.Fatalf("unexpected output:\n%s", out.String())
+	}
+	if strings.Contains(out.String(), "TOKEN_REFRESH_TIME") {
+		t.Fatalf("expected the deprecated setting to be accepted but not printed:\n%s", out.String())
+	}
+}
+
+func TestLoadRejectsUnknownFileSettings(t *testing.T) {
+	clearEnv(t)
+	path := writeFile(t, "config.yml", "prot: 8080\n")
+
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), `unknown setting "prot"`) {
+		t.Fatalf("expected unknown setting error, got %v", err)
+	}
+}
+
+func TestLoadYAMLBlockListsAndNesting(t *testing.T) {
+	clearEnv(t)
+	path := writeFile(t, "config.yaml", `
+ig_user_id: 1784
+app_id: app
+app_secret: >-
+  folded
+  secret
+token_sources:
+  - postgres # the database first
+  - disk
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AppSecret != "folded secret" || strings.Join(cfg.TokenSources, ",") != "postgres,disk" {
+		t.Errorf("unexpected values: %q %v", cfg.AppSecret, cfg.TokenSources)
+	}
+
+	path = writeFile(t, "config.yaml", "redis:\n  url: redis://a:6379\n")
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "nested objects are not supported") {
+		t.Fatalf("expected a nesting error, got %v", err)
+	}
+}
+
+func TestNewRedisClientModes(t *testing.T) {
+	if _, err := newRedisClient(Config{RedisMode: RedisSingle}); !errors.Is(err, ErrRedisNotConfigured) {
+		t.Fatalf("expected ErrRedisNotConfigured, got %v", err)
+	}
+
+	upstash, err := newRedisClient(Config{RedisMode: RedisSingle, UpstashURL: "https://redis.example:6379", UpstashToken: "redis-secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstash.Close()
+	if opt := upstash.(*redis.Client).Options(); opt.TLSConfig == nil || opt.Password != "redis-secret" {
+		t.Errorf("expected TLS and the Upstash token as password, got %+v", opt)
+	}
+
+	cluster, err := newRedisClient(Config{RedisMode: RedisCluster, RedisURL: "redis://a:6379?addr=b:6379"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Close()
+	if addrs := cluster.(*redis.ClusterClient).Options().Addrs; len(addrs) != 2 {
+		t.Errorf("expected both cluster nodes, got %v", addrs)
+	}
+
+	if _, err := newRedisClient(Config{RedisMode: RedisSentinel, RedisURL: "redis://a:26379"}); err == nil || !strings.Contains(err.Error(), "REDIS_SENTINEL_MASTER") {
+		t.Errorf("expected missing master error, got %v", err)
+	}
+	sentinel, err := newRedisClient(Config{RedisMode: RedisSentinel, RedisURL: "redis://a:26379", RedisSentinelMaster: "mymaster"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sentinel.Close()
+}
+
+func TestInstagramLoginDoesNotNeedAppCredentials(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("IG_USER_ID", "1784")
+	t.Setenv("LOGIN_PROVIDER", "instagram")
+	t.Setenv("IG_GRAPH_API_BASE_URL", "https://graph.instagram.com/")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.IGGraphAPIBaseURL != "https://graph.instagram.com" || cfg.IGGraphAPIVersion != "v24.0" {
+		t.Errorf("unexpected Instagram Graph settings: %s %s", cfg.IGGraphAPIBaseURL, cfg.IGGraphAPIVersion)
+	}
+
+	t.Setenv("IG_WEBHOOK_VERIFY_TOKEN", "verify-me")
+	if _, err := Load(""); err == nil || !strings.Contains(err.Error(), "APP_SECRET is required with IG_WEBHOOK_VERIFY_TOKEN") {
+		t.Fatalf("expected webhooks to need the app secret, got %v", err)
+	}
+	t.Setenv("APP_SECRET", "app-secret")
+	if _, err := Load(""); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("LOGIN_PROVIDER", "threads")
+	if _, err := Load(""); err == nil || !strings.Contains(err.Error(), "LOGIN_PROVIDER must be facebook or instagram") {
+		t.Fatalf("expected provider error, got %v", err)
+	}
+}
+
+func TestLoadAccounts(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("APP_ID", "app")
+	t.Setenv("APP_SECRET", "app-secret")
+	t.Setenv("ACCOUNTS", "clinic=1784, kids=1785")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Account{{"clinic", "1784"}, {"kids", "1785"}}
+	if len(cfg.Accounts) != 2 || cfg.Accounts[0] != want[0] || cfg.Accounts[1] != want[1] {
+		t.Fatalf("unexpected accounts: %v", cfg.Accounts)
+	}
+
+	t.Setenv("ACCOUNTS", "")
+	t.Setenv("IG_USER_ID", "1784")
+	if cfg, err = Load(""); err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Accounts) != 1 || cfg.Accounts[0] != (Account{DefaultAccount, "1784"}) {
+		t.Fatalf("expected the default account, got %v", cfg.Accounts)
+	}
+
+	for _, bad := range []string{"Clinic=1", "clinic", "a=1,a=2", "a=1,b=1"} {
+		t.Setenv("ACCOUNTS", bad)
+		if _, err := Load(""); err == nil || !strings.Contains(err.Error(), "ACCOUNTS:") {
+			t.Errorf("expected an ACCOUNTS error for %q, got %v", bad, err)
+		}
+	}
+}
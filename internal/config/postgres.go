@@ -2,12 +2,10 @@ package config
 
 import (
 	"database/sql"
-	"os"
 
 	_ "github.com/lib/pq"
 )
 
-func ConnectPostgres() (*sql.DB, error) {
-	dbURL := os.Getenv("DATABASE_URL")
+func ConnectPostgres(dbURL string) (*sql.DB, error) {
 	return sql.Open("postgres", dbURL)
 }
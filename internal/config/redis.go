@@ -2,43 +2,97 @@ package config
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
+	"strings"
 
 	"github.com/redis/go-redis/v9"
 )
 
 var ctx = context.Background()
 
-func ConnectRedis() (*redis.Client, error) {
-	// Get Redis URL from environment
-	redisURL := os.Getenv("UPSTASH_REDIS_REST_URL")
-	redisToken := os.Getenv("UPSTASH_REDIS_REST_TOKEN")
+// ErrRedisNotConfigured is returned by ConnectRedis when neither REDIS_URL nor
+// the Upstash settings are set, so the service runs without Redis
+var ErrRedisNotConfigured = errors.New("redis not configured")
 
-	if redisURL == "" || redisToken == "" {
-		return nil, fmt.Errorf("UPSTASH_REDIS_REST_URL or UPSTASH_REDIS_REST_TOKEN not set")
-	}
-
-	// Convert https:// to rediss:// for Upstash
-	if len(redisURL) > 8 && redisURL[:8] == "https://" {
-		redisURL = "rediss://" + redisURL[8:]
-	}
+// Redis modes accepted in REDIS_MODE
+const (
+	RedisSingle   = "single"
+	RedisSentinel = "sentinel"
+	RedisCluster  = "cluster"
+)
 
-	// Parse the URL
-	opt, err := redis.ParseURL(redisURL)
+// ConnectRedis connects to the Redis described by c. REDIS_URL is a standard
+// redis:// or rediss:// (TLS) URL; extra sentinel or cluster nodes are given
+// as addr= query parameters. REDIS_PASSWORD, when set, overrides the password
+// in the URL. The Upstash UPSTASH_REDIS_REST_URL and token pair is still
+// accepted when REDIS_URL is not set.
+func ConnectRedis(c Config) (redis.UniversalClient, error) {
+	client, err := newRedisClient(c)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
+		return nil, err
 	}
 
-	// Set the password from token
-	opt.Password = redisToken
-
-	client := redis.NewClient(opt)
-
 	// Test the connection
 	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
 	return client, nil
 }
+
+func newRedisClient(c Config) (redis.UniversalClient, error) {
+	redisURL, password := c.RedisURL, c.RedisPassword
+	if redisURL == "" {
+		if c.UpstashURL == "" {
+			return nil, ErrRedisNotConfigured
+		}
+		// Convert https:// to rediss:// for Upstash
+		redisURL = c.UpstashURL
+		if rest, ok := strings.CutPrefix(redisURL, "https://"); ok {
+			redisURL = "rediss://" + rest
+		}
+		if password == "" {
+			password = c.UpstashToken
+		}
+	}
+
+	switch c.RedisMode {
+	case RedisSentinel:
+		opt, err := redis.ParseFailoverURL(redisURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
+		}
+		if c.RedisSentinelMaster != "" {
+			opt.MasterName = c.RedisSentinelMaster
+		}
+		if opt.MasterName == "" {
+			return nil, errors.New("REDIS_SENTINEL_MASTER is required in sentinel mode")
+		}
+		if password != "" {
+			opt.Password = password
+		}
+		return redis.NewFailoverClient(opt), nil
+
+	case RedisCluster:
+		opt, err := redis.ParseClusterURL(redisURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
+		}
+		if password != "" {
+			opt.Password = password
+		}
+		return redis.NewClusterClient(opt), nil
+
+	default:
+		opt, err := redis.ParseURL(redisURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
+		}
+		if password != "" {
+			opt.Password = password
+		}
+		return redis.NewClient(opt), nil
+	}
+}
@@ -0,0 +1,187 @@
+package imaging
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"backend-service/internal/logging"
+)
+
+var logger = logging.Component("imaging")
+
+// DiskCache keeps encoded derivatives in a directory, evicting the least
+// recently used files once their total size passes a budget. Files are named
+// by a hash of their key, so any string can be a key.
+type DiskCache struct {
+	dir      string
+	maxBytes int64
+
+	mu    sync.Mutex
+	size  int64
+	lru   *list.List // of *cacheEntry, most recently used first
+	files map[string]*list.Element
+}
+
+type cacheEntry struct {
+	name string
+	size int64
+}
+
+const tempPrefix = ".tmp-"
+
+// NewDiskCache opens the cache in dir, creating it if needed. Files left by
+// a previous run are kept, oldest modification time evicted first.
+func NewDiskCache(dir string, maxBytes int64) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &DiskCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		files:    make(map[string]*list.Element),
+	}
+
+	type existing struct {
+		cacheEntry
+		modTime int64
+	}
+	var found []existing
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(e.Name(), tempPrefix) {
+			os.Remove(filepath.Join(dir, e.Name()))
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		found = append(found, existing{cacheEntry{e.Name(), info.Size()}, info.ModTime().UnixNano()})
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].modTime > found[j].modTime })
+	for _, f := range found {
+		entry := f.cacheEntry
+		c.files[entry.name] = c.lru.PushBack(&entry)
+		c.size += entry.size
+	}
+
+	c.mu.Lock()
+	c.evictLocked()
+	c.mu.Unlock()
+	return c, nil
+}
+
+// Get returns the cached data for key
+func (c *DiskCache) Get(key string) ([]byte, bool) {
+	name := fileName(key)
+
+	c.mu.Lock()
+	el, ok := c.files[name]
+	if ok {
+		c.lru.MoveToFront(el)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(filepath.Join(c.dir, name))
+	if err != nil {
+		logger.Warn("dropping unreadable cached image", "file", name, logging.Err(err))
+		c.remove(name)
+		return nil, false
+	}
+	return data, true
+}
+
+// Put stores data under key, replacing any previous value
+func (c *DiskCache) Put(key string, data []byte) error {
+	size := int64(len(data))
+	if size > c.maxBytes {
+		return errors.New("image is larger than the cache budget")
+	}
+	name := fileName(key)
+
+	tmp, err := os.CreateTemp(c.dir, tempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := os.Rename(tmp.Name(), filepath.Join(c.dir, name)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if el, ok := c.files[name]; ok {
+		c.size -= el.Value.(*cacheEntry).size
+		c.lru.Remove(el)
+	}
+	c.files[name] = c.lru.PushFront(&cacheEntry{name, size})
+	c.size += size
+	c.evictLocked()
+	return nil
+}
+
+// Size returns the total size of the cached files in bytes
+func (c *DiskCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+func (c *DiskCache) remove(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.files[name]; ok {
+		c.size -= el.Value.(*cacheEntry).size
+		c.lru.Remove(el)
+		delete(c.files, name)
+	}
+	os.Remove(filepath.Join(c.dir, name))
+}
+
+func (c *DiskCache) evictLocked() {
+	for c.size > c.maxBytes {
+		el := c.lru.Back()
+		if el == nil {
+			return
+		}
+		entry := el.Value.(*cacheEntry)
+		if err := os.Remove(filepath.Join(c.dir, entry.name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.Warn("failed to evict cached image", "file", entry.name, logging.Err(err))
+		}
+		c.lru.Remove(el)
+		delete(c.files, entry.name)
+		c.size -= entry.size
+	}
+}
+
+func fileName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,130 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"strings"
+	"testing"
+)
+
+func solid(w, h int, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
+
+func TestResizeKeepsAspectRatioAndAverages(t *testing.T) {
+	// Left half black, right half white
+	img := solid(1080, 1350, color.RGBA{A: 255})
+	for y := range 1350 {
+		for x := 540; x < 1080; x++ {
+			img.SetRGBA(x, y, color.RGBA{255, 255, 255, 255})
+		}
+	}
+
+	out := Resize(img, 320)
+	if out.Rect.Dx() != 320 || out.Rect.Dy() != 400 {
+		t.Fatalf("expected 320x400, got %v", out.Rect)
+	}
+	if left, right := out.RGBAAt(0, 0), out.RGBAAt(319, 399); left.R != 0 || right.R != 255 {
+		t.Fatalf("expected black and white corners, got %v and %v", left, right)
+	}
+
+	if same := Resize(img, 2000); same.Rect.Dx() != 1080 {
+		t.Fatalf("expected no upscaling, got width %d", same.Rect.Dx())
+	}
+}
+
+func TestBlurHashOfSolidColor(t *testing.T) {
+	img := solid(32, 32, color.RGBA{255, 0, 0, 255})
+
+	// A single component is just the size flag, a zero maximum and the
+	// average colour
+	if hash := BlurHash(img, 1, 1); hash != "00"+base83(0xFF0000, 4) {
+		t.Fatalf("expected the DC-only hash of pure red, got %s", hash)
+	}
+	if hash := BlurHash(img, 4, 3); len(hash) != 28 || hash[0] != 'L' || hash[2:6] != base83(0xFF0000, 4) {
+		t.Fatalf("expected a 4x3 hash with a red DC, got %s", hash)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	p, err := Describe(solid(640, 480, color.RGBA{10, 20, 30, 255}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Width != 640 || p.Height != 480 || len(p.BlurHash) != 28 {
+		t.Fatalf("unexpected placeholder %+v", p)
+	}
+	if !strings.HasPrefix(p.LQIP, "data:image/jpeg;base64,") {
+		t.Fatalf("expected a JPEG data URI, got %.40s", p.LQIP)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	if _, err := ParseFormat("avif"); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("expected ErrUnsupportedFormat, got %v", err)
+	}
+	if f, err := ParseFormat("webp"); err != nil || f != WebP {
+		t.Fatalf("expected webp to be accepted, got %q, %v", f, err)
+	}
+	if f, err := ParseFormat("jpg"); err != nil || f != JPEG {
+		t.Fatalf("expected jpg to mean jpeg, got %q, %v", f, err)
+	}
+}
+
+func TestDecodeRejectsHugeDimensions(t *testing.T) {
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, solid(1, 1, color.RGBA{A: 255}), nil); err != nil {
+		t.Fatal(err)
+	}
+	// A few bytes of GIF that declare a 65535x65535 screen
+	data := buf.Bytes()
+	copy(data[6:10], []byte{0xff, 0xff, 0xff, 0xff})
+
+	if _, err := Decode(bytes.NewReader(data)); !errors.Is(err, ErrImageTooLarge) {
+		t.Fatalf("expected ErrImageTooLarge, got %v", err)
+	}
+}
+
+func TestDiskCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewDiskCache(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"a", "b"} {
+		if err := cache.Put(key, bytes.Repeat([]byte(key), 4)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cache.Get("a")
+	if err := cache.Put("c", []byte("cccc")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := cache.Get("b"); ok {
+		t.Fatal("expected b to be evicted as least recently used")
+	}
+	if data, ok := cache.Get("a"); !ok || string(data) != "aaaa" {
+		t.Fatalf("expected a to survive, got %q", data)
+	}
+	if cache.Size() != 8 {
+		t.Fatalf("expected 8 bytes cached, got %d", cache.Size())
+	}
+
+	// A restart picks up what is on disk
+	reopened, err := NewDiskCache(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reopened.Get("c"); !ok || reopened.Size() != 8 {
+		t.Fatalf("expected the reopened cache to hold c and 8 bytes, got %d", reopened.Size())
+	}
+}
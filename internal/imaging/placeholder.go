@@ -0,0 +1,33 @@
+package imaging
+
+import (
+	"encoding/base64"
+	"image"
+
+	"backend-service/internal/instagram"
+)
+
+const (
+	// blurHashWidth is the width images are reduced to before hashing; the
+	// hash only keeps a few cosine components, so detail is wasted work
+	blurHashWidth = 32
+	lqipWidth     = 16
+)
+
+// Describe returns img's dimensions with a 4x3 BlurHash and a tiny JPEG
+// data: URI to show while the real image loads
+func Describe(img image.Image) (instagram.Placeholder, error) {
+	b := img.Bounds()
+	p := instagram.Placeholder{
+		Width:    b.Dx(),
+		Height:   b.Dy(),
+		BlurHash: BlurHash(Resize(img, blurHashWidth), 4, 3),
+	}
+
+	tiny, err := Derive(img, lqipWidth, JPEG)
+	if err != nil {
+		return instagram.Placeholder{}, err
+	}
+	p.LQIP = "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(tiny)
+	return p, nil
+}
@@ -0,0 +1,154 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/HugoSmits86/nativewebp"
+
+	// Decoders for the formats Instagram's CDN and our own derivatives use
+	_ "image/gif"
+)
+
+// Output formats. WebP is encoded lossless by a pure-Go encoder. AVIF has no
+// pure-Go encoder, so it is rejected rather than silently served as JPEG.
+const (
+	JPEG = "jpeg"
+	PNG  = "png"
+	WebP = "webp"
+)
+
+// ErrUnsupportedFormat is returned for an output format we cannot encode
+var ErrUnsupportedFormat = errors.New("unsupported image format")
+
+// ErrImageTooLarge is returned by Decode for images with more than maxPixels
+var ErrImageTooLarge = errors.New("image dimensions too large")
+
+// maxPixels bounds the decoded size of an image, well above the largest
+// Instagram serves. A small file can declare huge dimensions, and decoding
+// and resizing each allocate a full copy of its pixels.
+const maxPixels = 16 << 20
+
+// ContentType returns the MIME type of an output format
+func ContentType(format string) string {
+	return "image/" + format
+}
+
+// ParseFormat validates a requested output format; "jpg" is accepted for JPEG
+func ParseFormat(format string) (string, error) {
+	switch format {
+	case "", JPEG, "jpg":
+		return JPEG, nil
+	case PNG:
+		return PNG, nil
+	case WebP:
+		return WebP, nil
+	}
+	return "", fmt.Errorf("%w %q: use jpeg, png or webp", ErrUnsupportedFormat, format)
+}
+
+// Decode reads a JPEG, PNG or GIF image. Its header is checked first, and
+// images with more than maxPixels are rejected with ErrImageTooLarge before
+// any pixels are allocated.
+func Decode(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d", ErrImageTooLarge, cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// Encode writes img in format
+func Encode(w io.Writer, img image.Image, format string) error {
+	switch format {
+	case JPEG:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: 80})
+	case PNG:
+		return png.Encode(w, img)
+	case WebP:
+		return nativewebp.Encode(w, img, nil)
+	}
+	return fmt.Errorf("%w %q", ErrUnsupportedFormat, format)
+}
+
+// Derive scales img to width and encodes it in format
+func Derive(img image.Image, width int, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, Resize(img, width), format); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Resize scales img to width, keeping its aspect ratio. Each output pixel is
+// the average of the source pixels it covers, which keeps downscaled photos
+// free of aliasing. Images are never enlarged.
+func Resize(img image.Image, width int) *image.RGBA {
+	src := toRGBA(img)
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	if width <= 0 || width >= sw {
+		return src
+	}
+	height := max(1, (sh*width+sw/2)/sw)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		y0, y1 := span(y, height, sh)
+		for x := range width {
+			x0, x1 := span(x, width, sw)
+
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint32(p[0])
+					g += uint32(p[1])
+					b += uint32(p[2])
+					a += uint32(p[3])
+					n++
+				}
+			}
+
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0] = uint8((r + n/2) / n)
+			d[1] = uint8((g + n/2) / n)
+			d[2] = uint8((b + n/2) / n)
+			d[3] = uint8((a + n/2) / n)
+		}
+	}
+	return dst
+}
+
+// span returns the source pixels [lo, hi) covered by output pixel i of n,
+// always at least one
+func span(i, n, size int) (int, int) {
+	lo := i * size / n
+	hi := max((i+1)*size/n, lo+1)
+	return lo, hi
+}
+
+// toRGBA returns img as an RGBA image whose bounds start at the origin
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, b.Min, draw.Src)
+	return rgba
+}
@@ -0,0 +1,103 @@
+package instagram
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"backend-service/internal/logging"
+)
+
+// ErrCircuitOpen is returned without calling the Graph API while the circuit
+// breaker is open
+var ErrCircuitOpen = errors.New("graph API circuit breaker open")
+
+// breakerTransport stops calling the Graph API after threshold consecutive
+// requests fail with a network error or a 5xx response. After cooldown, a
+// single probe request is let through; its success closes the breaker and
+// its failure keeps it open for another cooldown.
+type breakerTransport struct {
+	next      http.RoundTripper
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time // zero while closed
+	probing  bool
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.allow() {
+		graphBreaker.WithLabelValues("rejected").Inc()
+		return nil, ErrCircuitOpen
+	}
+
+	res, err := t.next.RoundTrip(req)
+
+	switch {
+	case err != nil && (req.Context().Err() != nil || errors.Is(err, ErrRateLimited)):
+		// Neither says anything about Instagram's health
+		t.release()
+	case err != nil:
+		t.record(false, err)
+	default:
+		t.record(res.StatusCode < 500, nil)
+	}
+	return res, err
+}
+
+// allow reports whether a request may be sent, claiming the probe when the
+// cooldown has passed
+func (t *breakerTransport) allow() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.openedAt.IsZero() {
+		return true
+	}
+	if t.probing || time.Since(t.openedAt) < t.cooldown {
+		return false
+	}
+	t.probing = true
+	return true
+}
+
+// release gives up a probe without judging its outcome
+func (t *breakerTransport) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.probing = false
+}
+
+func (t *breakerTransport) record(ok bool, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	wasOpen := !t.openedAt.IsZero()
+	t.probing = false
+
+	if ok {
+		t.failures = 0
+		if wasOpen {
+			t.openedAt = time.Time{}
+			graphBreaker.WithLabelValues("closed").Inc()
+			logger.Info("graph API circuit breaker closed")
+		}
+		return
+	}
+
+	t.failures++
+	if wasOpen || t.failures >= t.threshold {
+		t.openedAt = time.Now()
+		if !wasOpen {
+			graphBreaker.WithLabelValues("opened").Inc()
+			attrs := []any{"failures", t.failures, "cooldown", t.cooldown.String()}
+			if err != nil {
+				attrs = append(attrs, logging.Err(err))
+			}
+			logger.Error("graph API circuit breaker opened", attrs...)
+		}
+	}
+}
@@ -2,11 +2,108 @@ package instagram
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	graphRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "graph_api_requests_total",
+		Help: "Graph API requests by endpoint and HTTP status (\"error\" when no response was received).",
+	}, []string{"endpoint", "status"})
+	graphDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "graph_api_request_duration_seconds",
+		Help: "Graph API request latency by endpoint and HTTP status.",
+	}, []string{"endpoint", "status"})
+	mediaFetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "graph_api_media_fetch_duration_seconds",
+		Help:    "Time to page through the media edge, including carousel children, by result.",
+		Buckets: []float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"result"})
+	graphRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "graph_api_retries_total",
+		Help: "Graph API requests repeated after a transient failure, by endpoint.",
+	}, []string{"endpoint"})
+	graphThrottled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "graph_api_throttled_total",
+		Help: "Graph API requests delayed or rejected because of reported rate limit usage.",
+	}, []string{"action"})
+	graphBreaker = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "graph_api_circuit_breaker_total",
+		Help: "Graph API circuit breaker events: opened, closed and rejected requests.",
+	}, []string{"event"})
 )
 
+// NewClient returns the HTTP client for Graph API calls. Requests pass
+// through, outermost first: a circuit breaker, retries with backoff, pacing
+// by reported rate limit usage, and metrics.
 func NewClient() *http.Client {
 	return &http.Client{
-		Timeout: time.Second * 5,
+		// Bounds the whole call including retries and pacing; each attempt
+		// has its own shorter timeout
+		Timeout:   time.Minute,
+		Transport: newTransport(instrumentedTransport{next: http.DefaultTransport}),
+	}
+}
+
+func newTransport(next http.RoundTripper) http.RoundTripper {
+	return &breakerTransport{
+		threshold: 5,
+		cooldown:  30 * time.Second,
+		next: &retryTransport{
+			maxAttempts:    3,
+			baseDelay:      500 * time.Millisecond,
+			maxDelay:       10 * time.Second,
+			attemptTimeout: 5 * time.Second,
+			next: &usageTransport{
+				slowAt:     75,
+				maxDelay:   5 * time.Second,
+				staleAfter: 5 * time.Minute,
+				blockFor:   time.Minute,
+				next:       next,
+			},
+		},
+	}
+}
+
+// instrumentedTransport records a count and latency for every Graph API call
+type instrumentedTransport struct {
+	next http.RoundTripper
+}
+
+func (t instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := t.next.RoundTrip(req)
+
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(res.StatusCode)
+	}
+	endpoint := graphEndpoint(req.URL.Path)
+	graphRequests.WithLabelValues(endpoint, status).Inc()
+	graphDuration.WithLabelValues(endpoint, status).Observe(time.Since(start).Seconds())
+
+	return res, err
+}
+
+// graphEndpoint names the kind of Graph API call without the object IDs in
+// the path
+func graphEndpoint(path string) string {
+	path = strings.TrimRight(path, "/")
+	switch {
+	case strings.HasSuffix(path, "/oauth/access_token"):
+		return "oauth_access_token"
+	case strings.HasSuffix(path, "/refresh_access_token"):
+		return "refresh_access_token"
+	case strings.HasSuffix(path, "/media"):
+		return "media"
+	case strings.HasSuffix(path, "/children"):
+		return "children"
+	default:
+		return "object"
 	}
 }
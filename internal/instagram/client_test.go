@@ -0,0 +1,177 @@
+package instagram
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// graphServer answers with the given status and body for the first len(fails)
+// requests and 200 {} afterwards, counting every request it sees
+func graphServer(t *testing.T, header http.Header, fails ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		for k, v := range header {
+			w.Header()[k] = v
+		}
+		if n <= len(fails) {
+			w.WriteHeader(fails[n-1])
+			w.Write([]byte(`{"error":{"message":"Please retry","type":"OAuthException","code":2,"fbtrace_id":"trace"}}`))
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestGetJSONReturnsTypedGraphError(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"message":"Unsupported get request.","type":"GraphMethodException","code":100,"error_subcode":33,"fbtrace_id":"AbC123"}}`))
+	})
+	service, url := newTestService(t, mux)
+
+	err := service.getJSON(url+"/gone", &struct{}{})
+
+	var gerr *GraphError
+	if !errors.As(err, &gerr) {
+		t.Fatalf("expected a GraphError, got %v", err)
+	}
+	if gerr.Code != 100 || gerr.Subcode != 33 || gerr.FBTraceID != "AbC123" || gerr.Type != "GraphMethodException" {
+		t.Fatalf("unexpected error fields: %+v", gerr)
+	}
+	if !errors.Is(err, ErrMediaNotFound) {
+		t.Fatal("expected a missing object to match ErrMediaNotFound")
+	}
+	if gerr.Transient() {
+		t.Fatal("a missing object is not transient")
+	}
+}
+
+func TestRetryTransportRetriesTransientErrors(t *testing.T) {
+	srv, calls := graphServer(t, nil, http.StatusServiceUnavailable, http.StatusInternalServerError)
+	client := &http.Client{Transport: &retryTransport{
+		next:           http.DefaultTransport,
+		maxAttempts:    3,
+		baseDelay:      time.Millisecond,
+		maxDelay:       10 * time.Millisecond,
+		attemptTimeout: time.Second,
+	}}
+
+	res, err := client.Get(srv.URL + "/test_user/media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK || calls.Load() != 3 {
+		t.Fatalf("expected success on the third attempt, got %d after %d calls", res.StatusCode, calls.Load())
+	}
+}
+
+func TestRetryTransportLeavesRateLimitsAlone(t *testing.T) {
+	srv, calls := graphServer(t, nil, http.StatusTooManyRequests)
+	client := &http.Client{Transport: &retryTransport{
+		next:           http.DefaultTransport,
+		maxAttempts:    3,
+		baseDelay:      time.Millisecond,
+		maxDelay:       10 * time.Millisecond,
+		attemptTimeout: time.Second,
+	}}
+
+	res, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if gerr := parseGraphError(res); !gerr.Throttled() || gerr.FBTraceID != "trace" {
+		t.Fatalf("expected the throttled response with its body, got %+v", gerr)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("expected no retries for a rate limit, got %d calls", calls.Load())
+	}
+}
+
+func TestUsageTransportPacesAndBlocks(t *testing.T) {
+	header := http.Header{
+		"X-App-Usage":               {`{"call_count":40,"total_cputime":10,"total_time":12}`},
+		"X-Business-Use-Case-Usage": {`{"1784":[{"type":"instagram","call_count":95,"total_cputime":20,"total_time":30,"estimated_time_to_regain_access":0}]}`},
+	}
+	srv, calls := graphServer(t, header)
+	usage := &usageTransport{
+		next:       http.DefaultTransport,
+		slowAt:     75,
+		maxDelay:   time.Minute,
+		staleAfter: time.Minute,
+		blockFor:   time.Minute,
+	}
+	client := &http.Client{Transport: usage}
+
+	res, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	// 95% is 80% of the way from 75 to 100
+	if d, err := usage.delay(); err != nil || d != 48*time.Second {
+		t.Fatalf("expected a 48s delay, got %v, %v", d, err)
+	}
+
+	usage.observe(&http.Response{
+		StatusCode: http.StatusBadRequest,
+		Header: http.Header{
+			"X-Business-Use-Case-Usage": {`{"1784":[{"type":"instagram","call_count":100,"estimated_time_to_regain_access":5}]}`},
+		},
+		Body: http.NoBody,
+	})
+	if _, err := client.Get(srv.URL); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited while blocked, got %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("expected no call while blocked, got %d", calls.Load())
+	}
+}
+
+func TestBreakerOpensAndRecovers(t *testing.T) {
+	srv, calls := graphServer(t, nil, http.StatusBadGateway, http.StatusBadGateway)
+	client := &http.Client{Transport: &breakerTransport{
+		next:      http.DefaultTransport,
+		threshold: 2,
+		cooldown:  20 * time.Millisecond,
+	}}
+
+	for range 2 {
+		res, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+
+	if _, err := client.Get(srv.URL); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("expected the open breaker to skip the call, got %d calls", calls.Load())
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	res, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("expected the probe to go through, got %v", err)
+	}
+	res.Body.Close()
+
+	if _, err := client.Get(srv.URL); err != nil {
+		t.Fatalf("expected the breaker to close after a successful probe, got %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package instagram
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxErrorBody bounds how much of an error response is read
+const maxErrorBody = 64 << 10
+
+// Graph API error codes that mean the request may succeed if repeated
+// https://developers.facebook.com/docs/graph-api/guides/error-handling
+var transientCodes = map[int]bool{
+	1: true, // unknown API error, possibly a temporary outage
+	2: true, // temporary service issue
+}
+
+// Graph API error codes for rate limiting, which lasts minutes rather than
+// the seconds a retry waits
+var throttleCodes = map[int]bool{
+	4:     true, // app rate limit
+	17:    true, // user rate limit
+	32:    true, // page rate limit
+	341:   true, // application limit reached
+	613:   true, // calls to this API have exceeded the rate limit
+	80002: true, // Instagram business use case rate limit
+}
+
+// Graph API error codes for a token that is expired, revoked or malformed
+const codeInvalidToken = 190
+
+// GraphError is an error response from the Graph API
+type GraphError struct {
+	StatusCode int
+	Message    string
+	Type       string
+	Code       int
+	Subcode    int
+	FBTraceID  string
+
+	// IsTransient is set when Graph marks the error as worth retrying
+	IsTransient bool
+}
+
+func (e *GraphError) Error() string {
+	msg := fmt.Sprintf("graph API error %d", e.StatusCode)
+	if e.Code != 0 {
+		msg += fmt.Sprintf(" (code %d", e.Code)
+		if e.Subcode != 0 {
+			msg += fmt.Sprintf(", subcode %d", e.Subcode)
+		}
+		msg += ")"
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.FBTraceID != "" {
+		msg += " [fbtrace_id " + e.FBTraceID + "]"
+	}
+	return msg
+}
+
+// Is reports a missing object as ErrMediaNotFound, whether Graph answered 404
+// or "object does not exist" (code 100, subcode 33)
+func (e *GraphError) Is(target error) bool {
+	if target != ErrMediaNotFound {
+		return false
+	}
+	return e.StatusCode == http.StatusNotFound || (e.Code == 100 && e.Subcode == 33)
+}
+
+// Transient reports whether repeating the request shortly may succeed
+func (e *GraphError) Transient() bool {
+	if e.Throttled() {
+		return false
+	}
+	return e.IsTransient || transientCodes[e.Code] || e.StatusCode >= 500
+}
+
+// Throttled reports whether the request was rejected by a rate limit
+func (e *GraphError) Throttled() bool {
+	return throttleCodes[e.Code] || e.StatusCode == http.StatusTooManyRequests
+}
+
+// InvalidToken reports whether the access token was rejected
+func (e *GraphError) InvalidToken() bool {
+	return e.Code == codeInvalidToken
+}
+
+// parseGraphError reads a non-200 response into a GraphError. A body that is
+// not Graph error JSON still yields an error carrying the status code. The
+// body is left readable, so each transport layer can inspect the response.
+func parseGraphError(res *http.Response) *GraphError {
+	gerr := &GraphError{StatusCode: res.StatusCode}
+
+	var body struct {
+		Error struct {
+			Message      string `json:"message"`
+			Type         string `json:"type"`
+			Code         int    `json:"code"`
+			ErrorSubcode int    `json:"error_subcode"`
+			IsTransient  bool   `json:"is_transient"`
+			FBTraceID    string `json:"fbtrace_id"`
+		} `json:"error"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBody))
+	res.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(data), res.Body), res.Body}
+
+	if json.Unmarshal(data, &body) == nil {
+		gerr.Message = body.Error.Message
+		gerr.Type = body.Error.Type
+		gerr.Code = body.Error.Code
+		gerr.Subcode = body.Error.ErrorSubcode
+		gerr.IsTransient = body.Error.IsTransient
+		gerr.FBTraceID = body.Error.FBTraceID
+	}
+	if gerr.FBTraceID == "" {
+		gerr.FBTraceID = res.Header.Get("X-Fb-Trace-Id")
+	}
+	if gerr.Message == "" {
+		gerr.Message = http.StatusText(res.StatusCode)
+	}
+	return gerr
+}
@@ -1,10 +1,39 @@
 package instagram
 
 type Media struct {
-	ID        string `json:"id"`
-	Caption   string `json:"caption"`
-	MediaType string `json:"media_type"`
-	MediaURL  string `json:"media_url"`
-	Permalink string `json:"permalink"`
-	Timestamp string `json:"timestamp"`
+	ID             string  `json:"id"`
+	Caption        string  `json:"caption"`
+	MediaType      string  `json:"media_type"`
+	MediaURL       string  `json:"media_url"`
+	ThumbnailURL   string  `json:"thumbnail_url,omitempty"`
+	Permalink      string  `json:"permalink"`
+	Timestamp      string  `json:"timestamp"`
+	Username       string  `json:"username,omitempty"`
+	LikeCount      int     `json:"like_count"`
+	CommentsCount  int     `json:"comments_count"`
+	IsSharedToFeed bool    `json:"is_shared_to_feed"`
+	Children       []Media `json:"children,omitempty"`
+
+	// Placeholder is computed by this service from the image, not returned by
+	// Instagram
+	Placeholder
+}
+
+// Placeholder describes a media item's image so clients can lay out and
+// blur-fill a grid before the image loads
+type Placeholder struct {
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+	BlurHash string `json:"blurhash,omitempty"`
+	// LQIP is a tiny JPEG as a data: URI
+	LQIP string `json:"lqip,omitempty"`
+}
+
+// ImageURL is the still image of the media: the cover for videos and the
+// media itself otherwise
+func (m Media) ImageURL() string {
+	if m.MediaType == "VIDEO" {
+		return m.ThumbnailURL
+	}
+	return m.MediaURL
 }
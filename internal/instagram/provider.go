@@ -0,0 +1,64 @@
+package instagram
+
+import (
+	"context"
+	"net/http"
+
+	"backend-service/internal/token"
+)
+
+// Login providers accepted in LOGIN_PROVIDER
+const (
+	ProviderFacebook  = "facebook"
+	ProviderInstagram = "instagram"
+)
+
+// Provider is the login flow the access token was issued by. It decides how
+// the token is refreshed and which Graph API host serves the account's media.
+type Provider interface {
+	Name() string
+	MediaBaseURL() string
+	Refresh(ctx context.Context, client *http.Client, current string) (token.Token, error)
+}
+
+// App is the Facebook Login provider: the Meta app that exchanges tokens
+// with the fb_exchange_token grant against graph.facebook.com
+type App struct {
+	// BaseURL is the versioned Graph API root, used for both token exchange
+	// and media
+	BaseURL string
+	ID      string
+	Secret  string
+}
+
+func (a App) Name() string         { return ProviderFacebook }
+func (a App) MediaBaseURL() string { return a.BaseURL }
+func (a App) Refresh(ctx context.Context, client *http.Client, current string) (token.Token, error) {
+	return RefreshAccessToken(ctx, client, a, current)
+}
+
+// InstagramLogin is the Instagram Login (formerly Basic Display) provider,
+// which refreshes tokens with the ig_refresh_token grant against
+// graph.instagram.com
+type InstagramLogin struct {
+	// BaseURL is the unversioned graph.instagram.com root, which serves
+	// refresh_access_token
+	BaseURL string
+
+	// Version is the API version media is fetched from, such as "v24.0";
+	// empty uses unversioned calls
+	Version string
+}
+
+func (l InstagramLogin) Name() string { return ProviderInstagram }
+
+func (l InstagramLogin) MediaBaseURL() string {
+	if l.Version == "" {
+		return l.BaseURL
+	}
+	return l.BaseURL + "/" + l.Version
+}
+
+func (l InstagramLogin) Refresh(ctx context.Context, client *http.Client, current string) (token.Token, error) {
+	return RefreshInstagramToken(ctx, client, l.BaseURL, current)
+}
@@ -0,0 +1,128 @@
+package instagram
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend-service/internal/logging"
+)
+
+// retryTransport repeats idempotent requests that failed with a network
+// error or a transient Graph API error, with exponential backoff and jitter.
+// Rate limit errors are left to usageTransport. Each attempt gets its own
+// timeout.
+type retryTransport struct {
+	next           http.RoundTripper
+	maxAttempts    int
+	baseDelay      time.Duration
+	maxDelay       time.Duration
+	attemptTimeout time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return t.next.RoundTrip(req)
+	}
+
+	endpoint := graphEndpoint(req.URL.Path)
+	for attempt := 1; ; attempt++ {
+		res, err := t.attempt(req)
+
+		var (
+			retry bool
+			wait  time.Duration
+		)
+		switch {
+		case err != nil:
+			// The caller gave up, or pacing refused the request
+			retry = req.Context().Err() == nil && !errors.Is(err, ErrRateLimited)
+		case res.StatusCode >= 400:
+			retry = parseGraphError(res).Transient()
+			wait = retryAfter(res.Header)
+		}
+		if !retry || attempt == t.maxAttempts {
+			return res, err
+		}
+
+		if wait == 0 {
+			wait = t.backoff(attempt)
+		}
+		wait = min(wait, t.maxDelay)
+
+		attrs := []any{"endpoint", endpoint, "attempt", attempt, "in", wait.String()}
+		if err != nil {
+			attrs = append(attrs, logging.Err(err))
+		} else {
+			attrs = append(attrs, "status", res.StatusCode)
+			res.Body.Close()
+		}
+		logger.Warn("retrying graph API request", attrs...)
+		graphRetries.WithLabelValues(endpoint).Inc()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt sends req once under the per-attempt timeout. An error response
+// body is buffered, so the timeout no longer applies to reading it.
+func (t *retryTransport) attempt(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), t.attemptTimeout)
+	res, err := t.next.RoundTrip(req.Clone(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	if res.StatusCode < 400 {
+		// The timeout also covers reading the body, as http.Client.Timeout does
+		res.Body = &cancelOnClose{ReadCloser: res.Body, cancel: cancel}
+		return res, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxErrorBody))
+	res.Body.Close()
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(data))
+	return res, nil
+}
+
+// backoff waits a random duration between half and all of base*2^(n-1)
+// after the n-th failed attempt
+func (t *retryTransport) backoff(attempt int) time.Duration {
+	d := min(t.baseDelay<<(attempt-1), t.maxDelay)
+	return d/2 + rand.N(d/2+1)
+}
+
+// retryAfter reads a Retry-After header given in seconds
+func retryAfter(h http.Header) time.Duration {
+	secs, err := strconv.Atoi(h.Get("Retry-After"))
+	if err != nil || secs <= 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
@@ -1,18 +1,27 @@
 package instagram
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
-	"os"
+	"net/url"
 	"time"
 
+	"backend-service/internal/logging"
 	"backend-service/internal/token"
 )
 
+var logger = logging.Component("instagram")
+
+// ErrMediaNotFound matches, with errors.Is, a GraphError for a media object
+// that Instagram no longer has
+var ErrMediaNotFound = errors.New("media not found")
+
 type Service struct {
 	Client     *http.Client
+	BaseURL    string
 	IgUserID   string
 	TokenStore *token.TokenRuntime
 }
@@ -21,13 +30,50 @@ func (s *Service) FetchMedia() ([]Media, error) {
 	return s.FetchMediaWithLimit(0) // 0 means fetch all
 }
 
+const (
+	mediaFields = "id,caption,media_type,media_url,thumbnail_url,permalink,timestamp,username,like_count,comments_count,is_shared_to_feed"
+	childFields = "id,media_type,media_url,thumbnail_url"
+)
+
+// graphMedia is a media node as returned by the Graph API, where the children
+// edge is wrapped in its own paged envelope.
+type graphMedia struct {
+	Media
+	Children *struct {
+		Data   []Media `json:"data"`
+		Paging struct {
+			Next string `json:"next"`
+		} `json:"paging"`
+	} `json:"children"`
+}
+
 func (s *Service) FetchMediaWithLimit(limit int) ([]Media, error) {
+	return s.fetchMedia(limit, nil)
+}
+
+// FetchMediaUntil pages through the account's media, newest first, and stops
+// at the first item for which stop returns true. That item and everything
+// after it are not returned, and no further pages are requested.
+func (s *Service) FetchMediaUntil(stop func(Media) bool) ([]Media, error) {
+	return s.fetchMedia(0, stop)
+}
+
+func (s *Service) fetchMedia(limit int, stop func(Media) bool) (media []Media, err error) {
+	start := time.Now()
+	defer func() {
+		result := "success"
+		if err != nil {
+			result = "error"
+		}
+		mediaFetchDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+	}()
+
 	token := s.TokenStore.Get()
 	var allMedia []Media
 
 	url := fmt.Sprintf(
-		os.Getenv("FB_API_BASE_URL")+"/%s/media?fields=id,caption,media_type,media_url,permalink,timestamp&access_token=%s",
-		s.IgUserID, token,
+		s.BaseURL+"/%s/media?fields=%s,children{%s}&access_token=%s",
+		s.IgUserID, mediaFields, childFields, token,
 	)
 
 	if limit > 0 {
@@ -35,31 +81,27 @@ func (s *Service) FetchMediaWithLimit(limit int) ([]Media, error) {
 	}
 
 	for url != "" {
-		res, err := s.Client.Get(url)
-		if err != nil {
-			return nil, err
-		}
-
-		if res.StatusCode != http.StatusOK {
-			log.Printf("[GRAPH API] through error with status %s", res.Status)
-			return nil, fmt.Errorf("[GRAPH API] through error with status %s", res.Status)
-		}
-
 		var result struct {
-			Data   []Media `json:"data"`
+			Data   []graphMedia `json:"data"`
 			Paging struct {
 				Next string `json:"next"`
 			} `json:"paging"`
 		}
 
-		err = json.NewDecoder(res.Body).Decode(&result)
-		res.Body.Close()
-
-		if err != nil {
+		if err := s.getJSON(url, &result); err != nil {
 			return nil, err
 		}
 
-		allMedia = append(allMedia, result.Data...)
+		for _, gm := range result.Data {
+			if stop != nil && stop(gm.Media) {
+				return allMedia, nil
+			}
+			media, err := s.resolveChildren(gm)
+			if err != nil {
+				return nil, err
+			}
+			allMedia = append(allMedia, media)
+		}
 
 		if limit > 0 && len(allMedia) >= limit {
 			return allMedia[:limit], nil
@@ -75,26 +117,141 @@ func (s *Service) FetchMediaWithLimit(limit int) ([]Media, error) {
 	return allMedia, nil
 }
 
-func RefreshAccessToken(client *http.Client, current string) (token.Token, error) {
+// resolveChildren flattens the children edge of an album into Media.Children,
+// following the edge's paging links when an album has more slides than fit in
+// the first page.
+func (s *Service) resolveChildren(gm graphMedia) (Media, error) {
+	media := gm.Media
+	media.Children = nil
+	if gm.Children == nil {
+		return media, nil
+	}
+
+	media.Children = append(media.Children, gm.Children.Data...)
+
+	next := gm.Children.Paging.Next
+	for next != "" {
+		var page struct {
+			Data   []Media `json:"data"`
+			Paging struct {
+				Next string `json:"next"`
+			} `json:"paging"`
+		}
+		if err := s.getJSON(next, &page); err != nil {
+			return Media{}, err
+		}
+		media.Children = append(media.Children, page.Data...)
+		next = page.Paging.Next
+	}
+
+	return media, nil
+}
+
+// ValidMediaID reports whether id looks like an Instagram media ID, which
+// are numeric. Anything else would change the Graph API request it is
+// placed in.
+func ValidMediaID(id string) bool {
+	if id == "" || len(id) > 32 {
+		return false
+	}
+	for _, r := range id {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// FetchMediaByID fetches a single media object, including its album children.
+// The error matches ErrMediaNotFound when Instagram no longer has the object,
+// when id is not a media ID, and when the object belongs to another account
+// than IgUserID, which a token shared between accounts can still read.
+func (s *Service) FetchMediaByID(id string) (Media, error) {
+	if !ValidMediaID(id) {
+		return Media{}, fmt.Errorf("%w: invalid media ID %q", ErrMediaNotFound, id)
+	}
+	endpoint := fmt.Sprintf(
+		s.BaseURL+"/%s?fields=%s,owner{id},children{%s}&access_token=%s",
+		url.PathEscape(id), mediaFields, childFields, s.TokenStore.Get(),
+	)
+
+	var gm struct {
+		graphMedia
+		Owner struct {
+			ID string `json:"id"`
+		} `json:"owner"`
+	}
+	if err := s.getJSON(endpoint, &gm); err != nil {
+		return Media{}, err
+	}
+	if gm.Owner.ID != s.IgUserID {
+		logger.Warn("ignoring media owned by another account", "id", id, "owner", gm.Owner.ID, "ig_user_id", s.IgUserID)
+		return Media{}, fmt.Errorf("%w: media %s belongs to another account", ErrMediaNotFound, id)
+	}
+	return s.resolveChildren(gm.graphMedia)
+}
+
+func (s *Service) getJSON(url string, out any) error {
+	res, err := s.Client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		gerr := parseGraphError(res)
+		if !errors.Is(gerr, ErrMediaNotFound) {
+			logger.Error("graph API request failed", "status", res.StatusCode, "code", gerr.Code,
+				"subcode", gerr.Subcode, "fbtrace_id", gerr.FBTraceID, "message", gerr.Message)
+		}
+		return gerr
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// RefreshAccessToken exchanges current for a new long-lived token with the
+// Facebook Login fb_exchange_token grant
+func RefreshAccessToken(ctx context.Context, client *http.Client, app App, current string) (token.Token, error) {
 	url := fmt.Sprintf(
-		os.Getenv("FB_API_BASE_URL")+"/oauth/access_token?grant_type=fb_exchange_token&client_id=%s&client_secret=%s&fb_exchange_token=%s",
-		os.Getenv("APP_ID"), os.Getenv("APP_SECRET"), current,
+		app.BaseURL+"/oauth/access_token?grant_type=fb_exchange_token&client_id=%s&client_secret=%s&fb_exchange_token=%s",
+		app.ID, app.Secret, current,
 	)
 
-	log.Printf("Refreshing token with URL: %s", url)
+	logger.Info("refreshing access token", "provider", app.Name())
+	return requestToken(ctx, client, url)
+}
 
-	res, err := client.Get(url)
+// RefreshInstagramToken extends current with the Instagram Login
+// ig_refresh_token grant. baseURL is the unversioned graph.instagram.com root.
+func RefreshInstagramToken(ctx context.Context, client *http.Client, baseURL, current string) (token.Token, error) {
+	url := fmt.Sprintf(
+		baseURL+"/refresh_access_token?grant_type=ig_refresh_token&access_token=%s",
+		current,
+	)
 
+	logger.Info("refreshing access token", "provider", ProviderInstagram)
+	return requestToken(ctx, client, url)
+}
+
+// requestToken calls a token endpoint and reads the token it returns
+func requestToken(ctx context.Context, client *http.Client, url string) (token.Token, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return token.Token{}, err
 	}
+	res, err := client.Do(req)
 
-	if res.StatusCode != http.StatusOK {
-		return token.Token{}, fmt.Errorf("[GRAPH API] through error with status %s", res.Status)
+	if err != nil {
+		return token.Token{}, err
 	}
 
 	defer res.Body.Close() // closing body to prevent memory leaks
 
+	if res.StatusCode != http.StatusOK {
+		return token.Token{}, parseGraphError(res)
+	}
+
 	var result struct {
 		AccessToken string `json:"access_token"`
 		ExpiresIn   int64  `json:"expires_in"`
@@ -0,0 +1,135 @@
+package instagram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend-service/internal/token"
+)
+
+func newTestService(t *testing.T, mux *http.ServeMux) (*Service, string) {
+	t.Helper()
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	rt := token.NewRuntime()
+	rt.Set(token.Token{AccessToken: "TEST_TOKEN"})
+
+	return &Service{
+		Client:     srv.Client(),
+		BaseURL:    srv.URL,
+		IgUserID:   "test_user",
+		TokenStore: rt,
+	}, srv.URL
+}
+
+func TestFetchMediaResolvesCarouselChildren(t *testing.T) {
+	mux := http.NewServeMux()
+	var baseURL string
+
+	mux.HandleFunc("/test_user/media", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"data": []map[string]any{
+				{
+					"id":         "album",
+					"media_type": "CAROUSEL_ALBUM",
+					"children": map[string]any{
+						"data":   []map[string]string{{"id": "c1"}, {"id": "c2"}},
+						"paging": map[string]string{"next": baseURL + "/album/children"},
+					},
+				},
+				{"id": "single", "media_type": "IMAGE"},
+			},
+		})
+	})
+	mux.HandleFunc("/album/children", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"data": []map[string]string{{"id": "c3"}},
+		})
+	})
+
+	service, url := newTestService(t, mux)
+	baseURL = url
+
+	media, err := service.FetchMedia()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(media) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(media))
+	}
+	if got := len(media[0].Children); got != 3 {
+		t.Fatalf("expected 3 children, got %d", got)
+	}
+	if media[0].Children[2].ID != "c3" {
+		t.Fatalf("expected last child c3, got %s", media[0].Children[2].ID)
+	}
+	if media[1].Children != nil {
+		t.Fatalf("expected no children for single image, got %v", media[1].Children)
+	}
+}
+
+func TestInstagramLoginRefreshesWithIgRefreshToken(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/refresh_access_token", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("grant_type") != "ig_refresh_token" || q.Get("access_token") != "OLD_TOKEN" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "REFRESHED_TOKEN",
+			"token_type":   "bearer",
+			"expires_in":   5184000,
+		})
+	})
+	service, url := newTestService(t, mux)
+
+	provider := InstagramLogin{BaseURL: url, Version: "v24.0"}
+	tok, err := provider.Refresh(context.Background(), service.Client, "OLD_TOKEN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != "REFRESHED_TOKEN" || time.Until(tok.ExpiresAt) < 59*24*time.Hour {
+		t.Fatalf("unexpected token: %+v", tok)
+	}
+	if got := provider.MediaBaseURL(); got != url+"/v24.0" {
+		t.Fatalf("unexpected media base URL %s", got)
+	}
+}
+
+func TestFetchMediaByIDOnlyReturnsOwnMedia(t *testing.T) {
+	mux := http.NewServeMux()
+	var requests int
+	mux.HandleFunc("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		owner := "test_user"
+		if r.PathValue("id") == "2" {
+			owner = "other_account"
+		}
+		json.NewEncoder(w).Encode(map[string]any{"id": r.PathValue("id"), "owner": map[string]string{"id": owner}})
+	})
+	svc, _ := newTestService(t, mux)
+
+	if media, err := svc.FetchMediaByID("1"); err != nil || media.ID != "1" {
+		t.Fatalf("expected own media, got %+v, %v", media, err)
+	}
+	if _, err := svc.FetchMediaByID("2"); !errors.Is(err, ErrMediaNotFound) {
+		t.Fatalf("expected another account's media to be not found, got %v", err)
+	}
+	for _, id := range []string{"", "1?fields=x", "../me", "1/children"} {
+		if _, err := svc.FetchMediaByID(id); !errors.Is(err, ErrMediaNotFound) {
+			t.Fatalf("expected %q to be rejected, got %v", id, err)
+		}
+	}
+	if requests != 2 {
+		t.Fatalf("expected invalid IDs not to reach the Graph API, got %d requests", requests)
+	}
+}
@@ -0,0 +1,144 @@
+package instagram
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned without calling the Graph API while Meta has
+// told us we are over a rate limit
+var ErrRateLimited = errors.New("graph API rate limit reached")
+
+// usageTransport paces requests using the rate limit usage Meta reports in
+// the X-App-Usage and X-Business-Use-Case-Usage headers. Once usage passes
+// slowAt percent each request is delayed, up to maxDelay as usage nears 100,
+// so we slow down before Meta starts rejecting calls. After a throttled
+// response, requests fail fast with ErrRateLimited until access is regained.
+type usageTransport struct {
+	next     http.RoundTripper
+	slowAt   float64
+	maxDelay time.Duration
+
+	// usage readings older than staleAfter are ignored, since Meta's window
+	// rolls over and the figure only falls while we are idle
+	staleAfter time.Duration
+
+	// blockFor is how long to stop calling after a throttled response that
+	// does not say when access is regained
+	blockFor time.Duration
+
+	mu           sync.Mutex
+	usage        float64
+	readAt       time.Time
+	blockedUntil time.Time
+}
+
+func (t *usageTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	delay, err := t.delay()
+	if err != nil {
+		graphThrottled.WithLabelValues("rejected").Inc()
+		return nil, err
+	}
+	if delay > 0 {
+		graphThrottled.WithLabelValues("delayed").Inc()
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+
+	res, err := t.next.RoundTrip(req)
+	if err == nil {
+		t.observe(res)
+	}
+	return res, err
+}
+
+// delay is how long to hold the next request, or ErrRateLimited while blocked
+func (t *usageTransport) delay() (time.Duration, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(t.blockedUntil) {
+		return 0, fmt.Errorf("%w, retry after %s", ErrRateLimited, t.blockedUntil.Format(time.RFC3339))
+	}
+	if t.usage < t.slowAt || now.Sub(t.readAt) > t.staleAfter {
+		return 0, nil
+	}
+	share := min((t.usage-t.slowAt)/(100-t.slowAt), 1)
+	return time.Duration(share * float64(t.maxDelay)), nil
+}
+
+// observe records the usage reported on res, and blocks further calls when
+// res is a rate limit error
+func (t *usageTransport) observe(res *http.Response) {
+	usage, regain := parseUsage(res.Header)
+
+	var throttled bool
+	if res.StatusCode >= 400 {
+		throttled = parseGraphError(res).Throttled()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if usage >= 0 {
+		t.usage, t.readAt = usage, now
+	}
+	if throttled && regain == 0 {
+		regain = t.blockFor
+	}
+	if regain > 0 {
+		if until := now.Add(regain); until.After(t.blockedUntil) {
+			t.blockedUntil = until
+			logger.Warn("graph API rate limit reached, pausing calls", "until", until, "usage_percent", usage)
+		}
+	}
+}
+
+// parseUsage returns the highest usage percentage reported in the headers,
+// or -1 when there is none, and how long until throttled access is regained
+func parseUsage(h http.Header) (float64, time.Duration) {
+	type counters struct {
+		CallCount    float64 `json:"call_count"`
+		TotalCPUTime float64 `json:"total_cputime"`
+		TotalTime    float64 `json:"total_time"`
+
+		// EstimatedTimeToRegainAccess is in minutes
+		EstimatedTimeToRegainAccess float64 `json:"estimated_time_to_regain_access"`
+	}
+
+	usage := -1.0
+	var regain time.Duration
+	note := func(c counters) {
+		usage = max(usage, c.CallCount, c.TotalCPUTime, c.TotalTime)
+		regain = max(regain, time.Duration(c.EstimatedTimeToRegainAccess*float64(time.Minute)))
+	}
+
+	if v := h.Get("X-App-Usage"); v != "" {
+		var app counters
+		if json.Unmarshal([]byte(v), &app) == nil {
+			note(app)
+		}
+	}
+	if v := h.Get("X-Business-Use-Case-Usage"); v != "" {
+		var business map[string][]counters
+		if json.Unmarshal([]byte(v), &business) == nil {
+			for _, cases := range business {
+				for _, c := range cases {
+					note(c)
+				}
+			}
+		}
+	}
+	return usage, regain
+}
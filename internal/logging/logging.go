@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+)
+
+// Setup installs a JSON logger at the given level ("debug", "info", "warn"
+// or "error") as the slog default. Every record passes through the redaction
+// layer before it is written.
+func Setup(level string) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(strings.TrimSpace(level))); err != nil {
+		lvl = slog.LevelInfo
+	}
+
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: lvl})
+	slog.SetDefault(slog.New(&redactingHandler{next: handler}))
+}
+
+// Component returns a logger tagged with component=name. It resolves the
+// default handler on every record, so package-level loggers created before
+// Setup still use the configured output.
+func Component(name string) *slog.Logger {
+	return slog.New(&defaultHandler{}).With("component", name)
+}
+
+// defaultHandler forwards to whatever slog.Default() is at the time of the
+// call. WithAttrs and WithGroup calls are recorded in order and replayed on
+// that handler, so attributes added after a group nest inside it. The result
+// is cached until the default handler changes.
+type defaultHandler struct {
+	steps []func(slog.Handler) slog.Handler
+	built atomic.Pointer[builtHandler]
+}
+
+// builtHandler is the steps replayed on base
+type builtHandler struct {
+	base    slog.Handler
+	handler slog.Handler
+}
+
+func (h *defaultHandler) handler() slog.Handler {
+	base := slog.Default().Handler()
+	// Handlers that cannot be compared are rebuilt every time rather than
+	// panicking on the comparison
+	cacheable := reflect.TypeOf(base).Comparable()
+	if b := h.built.Load(); cacheable && b != nil && b.base == base {
+		return b.handler
+	}
+
+	next := base
+	for _, step := range h.steps {
+		next = step(next)
+	}
+	if cacheable {
+		h.built.Store(&builtHandler{base: base, handler: next})
+	}
+	return next
+}
+
+func (h *defaultHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler().Enabled(ctx, level)
+}
+
+func (h *defaultHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.handler().Handle(ctx, r)
+}
+
+func (h *defaultHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler { return next.WithAttrs(attrs) })
+}
+
+func (h *defaultHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler { return next.WithGroup(name) })
+}
+
+func (h *defaultHandler) with(step func(slog.Handler) slog.Handler) slog.Handler {
+	steps := append(append([]func(slog.Handler) slog.Handler{}, h.steps...), step)
+	return &defaultHandler{steps: steps}
+}
+
+// Err is the conventional attribute for an error
+func Err(err error) slog.Attr {
+	if err == nil {
+		return slog.String("error", "")
+	}
+	return slog.String("error", err.Error())
+}
+
+// Fatal logs at error level and exits, replacing log.Fatal
+func Fatal(logger *slog.Logger, msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
+
+// ValidLevel reports whether level is a level name Setup understands
+func ValidLevel(level string) bool {
+	var lvl slog.Level
+	return lvl.UnmarshalText([]byte(strings.TrimSpace(level))) == nil
+}
@@ -0,0 +1,48 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestComponentGroupsNest(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	defer slog.SetDefault(previous)
+
+	Component("test").WithGroup("a").With("x", 1).WithGroup("b").Info("hello", "y", 2)
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	a, _ := got["a"].(map[string]any)
+	b, _ := a["b"].(map[string]any)
+	if got["component"] != "test" || a["x"] != 1.0 || b["y"] != 2.0 {
+		t.Fatalf("expected nested groups a{x, b{y}}, got %s", buf.String())
+	}
+}
+
+func TestComponentFollowsDefaultHandlerChanges(t *testing.T) {
+	var first, second bytes.Buffer
+	previous := slog.Default()
+	defer slog.SetDefault(previous)
+
+	logger := Component("test").With("x", 1)
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&first, nil)))
+	logger.Info("one")
+	if allocs := testing.AllocsPerRun(100, func() { logger.Enabled(context.Background(), slog.LevelInfo) }); allocs != 0 {
+		t.Fatalf("expected the built handler to be reused, got %v allocations per call", allocs)
+	}
+
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&second, nil)))
+	logger.Info("two")
+
+	if !bytes.Contains(first.Bytes(), []byte(`"msg":"one"`)) || !bytes.Contains(second.Bytes(), []byte(`"msg":"two","component":"test","x":1`)) {
+		t.Fatalf("expected each record to reach the default handler of its time, got %q and %q", first.String(), second.String())
+	}
+}
@@ -0,0 +1,124 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveParams matches credentials passed as query or form parameters
+var sensitiveParams = regexp.MustCompile(
+	`(?i)\b(access_token|client_secret|fb_exchange_token|input_token|appsecret_proof|ig_refresh_token)=[^&\s"']+`,
+)
+
+var bearerToken = regexp.MustCompile(`(?i)\bBearer\s+[^\s"']+`)
+
+var (
+	secretsMu sync.RWMutex
+	secrets   []string
+	// named holds secrets that are replaced over time, such as each
+	// account's current access token, keyed by the name they were set under
+	named = make(map[string]string)
+)
+
+// AddSecret registers a value, such as the app secret or the current access
+// token, that must never appear in logs. Short values are ignored to avoid
+// masking unrelated text.
+func AddSecret(s string) {
+	if len(s) < 8 {
+		return
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, existing := range secrets {
+		if existing == s {
+			return
+		}
+	}
+	secrets = append(secrets, s)
+}
+
+// SetSecret registers value under name, replacing the value previously set
+// under that name, so a refreshed access token takes the place of the one
+// it replaced instead of the list growing with every refresh. A value that
+// AddSecret would ignore removes the name.
+func SetSecret(name, value string) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	if len(value) < 8 {
+		delete(named, name)
+		return
+	}
+	named[name] = value
+}
+
+// Redact masks access tokens, client secrets and registered secret values in s
+func Redact(s string) string {
+	s = sensitiveParams.ReplaceAllString(s, "$1="+redacted)
+	s = bearerToken.ReplaceAllString(s, "Bearer "+redacted)
+
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	for _, secret := range named {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	return s
+}
+
+// redactingHandler applies Redact to the message and every string or error
+// attribute before passing the record on
+type redactingHandler struct {
+	next slog.Handler
+}
+
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *redactingHandler) Handle(ctx context.Context, r slog.Record) error {
+	clean := slog.NewRecord(r.Time, r.Level, Redact(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		clean.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.next.Handle(ctx, clean)
+}
+
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clean := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		clean[i] = redactAttr(a)
+	}
+	return &redactingHandler{next: h.next.WithAttrs(clean)}
+}
+
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{next: h.next.WithGroup(name)}
+}
+
+func redactAttr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Redact(v.String()))
+	case slog.KindGroup:
+		group := v.Group()
+		clean := make([]any, len(group))
+		for i, g := range group {
+			clean[i] = redactAttr(g)
+		}
+		return slog.Group(a.Key, clean...)
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return slog.String(a.Key, Redact(err.Error()))
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
@@ -0,0 +1,77 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	AddSecret("super-secret-app-value")
+
+	cases := map[string]string{
+		"GET /oauth/access_token?grant_type=fb_exchange_token&client_secret=abc123&fb_exchange_token=EAAB": "GET /oauth/access_token?grant_type=fb_exchange_token&client_secret=[REDACTED]&fb_exchange_token=[REDACTED]",
+		`Get "https://graph.example/me/media?fields=id&access_token=EAAXYZ": dial tcp`:                     `Get "https://graph.example/me/media?fields=id&access_token=[REDACTED]": dial tcp`,
+		"Authorization: Bearer abc.def.ghi":    "Authorization: Bearer [REDACTED]",
+		"app secret is super-secret-app-value": "app secret is [REDACTED]",
+		"nothing to hide here":                 "nothing to hide here",
+	}
+	for in, want := range cases {
+		if got := Redact(in); got != want {
+			t.Errorf("Redact(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRedactingHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(&redactingHandler{next: slog.NewJSONHandler(&buf, nil)})
+
+	err := errors.New(`Get "https://graph.example/me?access_token=EAAXYZ": timeout`)
+	logger.With("url", "/x?access_token=EAAXYZ").Error("request to ?access_token=EAAXYZ failed",
+		"error", err,
+		slog.Group("req", "query", "input_token=EAAXYZ"),
+	)
+
+	out := buf.String()
+	if strings.Contains(out, "EAAXYZ") {
+		t.Fatalf("token leaked into log output: %s", out)
+	}
+	if strings.Count(out, "[REDACTED]") != 4 {
+		t.Fatalf("expected every occurrence to be redacted: %s", out)
+	}
+}
+
+func TestComponentUsesCurrentDefault(t *testing.T) {
+	logger := Component("test")
+
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	defer slog.SetDefault(prev)
+
+	logger.Info("hello")
+	if !strings.Contains(buf.String(), `"component":"test"`) {
+		t.Fatalf("expected component attribute in %s", buf.String())
+	}
+}
+
+func TestSetSecretReplacesPreviousValue(t *testing.T) {
+	SetSecret("access_token:test", "FIRST_TOKEN_VALUE")
+	SetSecret("access_token:test", "SECOND_TOKEN_VALUE")
+	SetSecret("access_token:other", "OTHER_TOKEN_VALUE")
+	defer SetSecret("access_token:test", "")
+	defer SetSecret("access_token:other", "")
+
+	if got := Redact("SECOND_TOKEN_VALUE OTHER_TOKEN_VALUE"); got != "[REDACTED] [REDACTED]" {
+		t.Fatalf("expected current values masked, got %q", got)
+	}
+	if got := Redact("FIRST_TOKEN_VALUE"); got != "FIRST_TOKEN_VALUE" {
+		t.Fatalf("expected the replaced value to be dropped, got %q", got)
+	}
+	if len(named) != 2 {
+		t.Fatalf("expected one secret per name, got %d", len(named))
+	}
+}
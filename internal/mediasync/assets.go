@@ -0,0 +1,284 @@
+package mediasync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"backend-service/internal/imaging"
+	"backend-service/internal/instagram"
+	"backend-service/internal/logging"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var urlRefreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "media_content_url_refreshes_total",
+	Help: "Expired CDN URLs refetched from the Graph API, by result.",
+}, []string{"result"})
+
+// ErrNoAsset is returned when a media item has no URL for the requested file
+var ErrNoAsset = errors.New("media has no content")
+
+const (
+	// placeholderWorkers bounds concurrent image downloads while filling
+	// placeholders, so a cold cache does not flood the CDN
+	placeholderWorkers = 4
+	// maxImageBytes bounds how much of an image is read for decoding;
+	// imaging.Decode separately bounds its dimensions
+	maxImageBytes = 32 << 20
+	// placeholderTimeout bounds downloading and decoding one image for its
+	// placeholder, so a stalled CDN connection cannot hold up a media sync
+	placeholderTimeout = 30 * time.Second
+)
+
+// NewCDNClient returns an HTTP client for Instagram's CDN. Connecting and
+// waiting for response headers are bounded, but there is no overall timeout:
+// a video is streamed for as long as the client reads it.
+func NewCDNClient() *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 15 * time.Second,
+			ExpectContinueTimeout: time.Second,
+			IdleConnTimeout:       90 * time.Second,
+			MaxIdleConns:          100,
+		},
+	}
+}
+
+// Assets fetches media files from Instagram's CDN. The signed URLs in the
+// cache expire after a few days; when the CDN answers 403 or 410 the item is
+// refetched from the Graph API and the request retried once with the new URL.
+type Assets struct {
+	Syncer *Syncer
+
+	// Client fetches from the CDN. It should not be the Graph API client, whose
+	// retries, usage pacing and circuit breaker are meant for API calls.
+	Client *http.Client
+
+	refreshMu  sync.Mutex
+	refreshing map[string]*urlRefresh
+
+	failedMu sync.Mutex
+	failed   map[string]bool
+}
+
+// urlRefresh is a refetch of one media item that concurrent requests for the
+// same ID wait on
+type urlRefresh struct {
+	done chan struct{}
+	err  error
+}
+
+// Cached reports whether media id is in the cache
+func (a *Assets) Cached(id string) bool {
+	_, ok := a.lookup(id)
+	return ok
+}
+
+// Open requests the file that asset picks from media id, such as its
+// MediaURL or ImageURL, passing header on to the CDN. The error matches
+// instagram.ErrMediaNotFound when the media does not exist and ErrNoAsset
+// when it has no such file. Any CDN response other than an expired URL is
+// returned as is.
+func (a *Assets) Open(ctx context.Context, method, id string, asset func(instagram.Media) string, header http.Header) (*http.Response, error) {
+	media, ok := a.lookup(id)
+	if !ok {
+		if !instagram.ValidMediaID(id) {
+			return nil, instagram.ErrMediaNotFound
+		}
+		a.Syncer.RefreshMissing([]string{id})
+		if media, ok = a.lookup(id); !ok {
+			return nil, instagram.ErrMediaNotFound
+		}
+	}
+
+	url := asset(media)
+	if url == "" {
+		return nil, ErrNoAsset
+	}
+
+	res, err := a.fetch(ctx, method, url, header)
+	if err != nil || !expired(res.StatusCode) {
+		return res, err
+	}
+	res.Body.Close()
+
+	if url, err = a.refreshURL(id, url, asset); err != nil {
+		return nil, err
+	}
+	return a.fetch(ctx, method, url, header)
+}
+
+// FillPlaceholders computes dimensions, BlurHash and LQIP for cached media
+// that has none yet. Images that cannot be downloaded or decoded are not
+// retried until the process restarts.
+func (a *Assets) FillPlaceholders(ctx context.Context) {
+	var todo []instagram.Media
+	a.failedMu.Lock()
+	for _, media := range a.Syncer.Store.MissingPlaceholders() {
+		if !a.failed[media.ID] {
+			todo = append(todo, media)
+		}
+	}
+	a.failedMu.Unlock()
+	if len(todo) == 0 {
+		return
+	}
+
+	var (
+		mu      sync.Mutex
+		results = make(map[string]instagram.Placeholder, len(todo))
+		queue   = make(chan instagram.Media)
+		wg      sync.WaitGroup
+	)
+	for range min(placeholderWorkers, len(todo)) {
+		wg.Go(func() {
+			for media := range queue {
+				p, err := a.placeholder(ctx, media.ID)
+				if err != nil {
+					if ctx.Err() == nil {
+						logger.Warn("failed to compute media placeholder", "id", media.ID, logging.Err(err))
+						a.markFailed(media.ID)
+					}
+					continue
+				}
+				mu.Lock()
+				results[media.ID] = p
+				mu.Unlock()
+			}
+		})
+	}
+	for _, media := range todo {
+		if ctx.Err() != nil {
+			break
+		}
+		queue <- media
+	}
+	close(queue)
+	wg.Wait()
+
+	a.Syncer.Store.SetPlaceholders(results)
+}
+
+func (a *Assets) placeholder(ctx context.Context, id string) (instagram.Placeholder, error) {
+	ctx, cancel := context.WithTimeout(ctx, placeholderTimeout)
+	defer cancel()
+
+	img, err := a.Image(ctx, id)
+	if err != nil {
+		return instagram.Placeholder{}, err
+	}
+	return imaging.Describe(img)
+}
+
+// Image downloads and decodes the still image of media id
+func (a *Assets) Image(ctx context.Context, id string) (image.Image, error) {
+	res, err := a.Open(ctx, http.MethodGet, id, instagram.Media.ImageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CDN answered %d", res.StatusCode)
+	}
+	return imaging.Decode(io.LimitReader(res.Body, maxImageBytes))
+}
+
+func (a *Assets) markFailed(id string) {
+	a.failedMu.Lock()
+	defer a.failedMu.Unlock()
+	if a.failed == nil {
+		a.failed = make(map[string]bool)
+	}
+	a.failed[id] = true
+}
+
+func (a *Assets) lookup(id string) (instagram.Media, bool) {
+	found := a.Syncer.Store.GetByIDs([]string{id})
+	if len(found) == 0 {
+		return instagram.Media{}, false
+	}
+	return found[0], true
+}
+
+func (a *Assets) fetch(ctx context.Context, method, url string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	return a.Client.Do(req)
+}
+
+// refreshURL refetches the media from the Graph API and returns its new URL.
+// Refreshes are serialized so concurrent requests for an expired asset share
+// the first one's result instead of each calling Instagram.
+func (a *Assets) refreshURL(id, stale string, asset func(instagram.Media) string) (string, error) {
+	a.refreshMu.Lock()
+	r, shared := a.refreshing[id]
+	if !shared {
+		r = &urlRefresh{done: make(chan struct{})}
+		if a.refreshing == nil {
+			a.refreshing = make(map[string]*urlRefresh)
+		}
+		a.refreshing[id] = r
+	}
+	a.refreshMu.Unlock()
+
+	if shared {
+		<-r.done
+	} else {
+		// A refresh that finished since our fetch may already have a new URL
+		if media, ok := a.lookup(id); ok && asset(media) != stale {
+			shared = true
+		} else {
+			r.err = a.Syncer.UpsertMedia(id)
+		}
+		a.refreshMu.Lock()
+		delete(a.refreshing, id)
+		a.refreshMu.Unlock()
+		close(r.done)
+	}
+
+	if r.err != nil {
+		urlRefreshes.WithLabelValues("error").Inc()
+		return "", r.err
+	}
+	media, ok := a.lookup(id)
+	if !ok {
+		urlRefreshes.WithLabelValues("deleted").Inc()
+		return "", instagram.ErrMediaNotFound
+	}
+	if asset(media) == stale {
+		urlRefreshes.WithLabelValues("unchanged").Inc()
+		return "", fmt.Errorf("CDN URL for media %s is expired but Instagram returned the same URL", id)
+	}
+	if shared {
+		urlRefreshes.WithLabelValues("shared").Inc()
+	} else {
+		urlRefreshes.WithLabelValues("refreshed").Inc()
+		logger.Info("refreshed expired media URL", "id", id)
+	}
+	return asset(media), nil
+}
+
+// expired reports whether the CDN rejected a signed URL that is no longer valid
+func expired(status int) bool {
+	return status == http.StatusForbidden || status == http.StatusGone
+}
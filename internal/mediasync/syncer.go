@@ -0,0 +1,345 @@
+package mediasync
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"backend-service/internal/cache"
+	"backend-service/internal/instagram"
+	"backend-service/internal/logging"
+)
+
+var logger = logging.Component("mediasync")
+
+// Syncer keeps a cache.Store in line with the Instagram account. Regular runs
+// are incremental and only fetch media newer than what is cached; every
+// ReconcileEvery a full fetch replaces the cache so deleted posts drop out.
+type Syncer struct {
+	Store          *cache.Store
+	Service        *instagram.Service
+	ReconcileEvery time.Duration
+
+	// Archive, when set, records every fetched item and every deletion
+	Archive Archive
+
+	// MinRefreshInterval is the window in which RefreshMissing looks up at
+	// most maxLookupsPerInterval unknown IDs. NegativeTTL is how long IDs
+	// Instagram does not have are remembered as not existing. Zero means the
+	// default.
+	MinRefreshInterval time.Duration
+	NegativeTTL        time.Duration
+
+	mu            sync.Mutex
+	lastReconcile time.Time
+
+	flightMu    sync.Mutex
+	flights     map[string]*flight
+	windowStart time.Time
+	lookups     int
+	missing     map[string]time.Time
+}
+
+// Archive keeps a durable history of media outside the cache, and serves
+// what it last saw when Instagram cannot be reached and the cache is empty
+type Archive interface {
+	Upsert(media []instagram.Media) error
+	MarkDeleted(ids []string) error
+	LoadActive() ([]instagram.Media, time.Time, error)
+}
+
+const (
+	defaultMinRefreshInterval = 30 * time.Second
+	defaultNegativeTTL        = 10 * time.Minute
+
+	// maxLookupsPerInterval caps the Graph API calls RefreshMissing makes per
+	// MinRefreshInterval, so requests for made-up IDs cannot flood Instagram
+	maxLookupsPerInterval = 20
+
+	// maxMissing caps the negative cache; IDs beyond it are simply looked up
+	// again within the lookup budget
+	maxMissing = 10000
+)
+
+// flight is a lookup in progress that concurrent callers wait on
+type flight struct {
+	done chan struct{}
+}
+
+// Run performs one sync pass. It is meant to be used as the scheduler's sync
+// function; a run that starts while another is in progress is skipped.
+func (s *Syncer) Run() {
+	if !s.mu.TryLock() {
+		logger.Info("sync already in progress, skipping")
+		return
+	}
+	defer s.mu.Unlock()
+
+	if s.lastReconcile.IsZero() || time.Since(s.lastReconcile) >= s.ReconcileEvery {
+		if err := s.reconcileLocked(); err != nil {
+			logger.Error("full reconcile failed", logging.Err(err))
+			s.RestoreFromArchive()
+		}
+		return
+	}
+
+	if err := s.incrementalLocked(); err != nil {
+		logger.Error("incremental sync failed", logging.Err(err))
+		s.RestoreFromArchive()
+	}
+}
+
+// RestoreFromArchive fills an empty cache from the archive. It is used when
+// Instagram cannot be reached and neither the snapshot nor an earlier fetch
+// left anything to serve, at boot or later.
+func (s *Syncer) RestoreFromArchive() {
+	if s.Archive == nil || s.Store.Len() > 0 {
+		return
+	}
+	media, lastSeen, err := s.Archive.LoadActive()
+	if err != nil {
+		logger.Error("failed to load media archive", logging.Err(err))
+		return
+	}
+	if len(media) > 0 {
+		s.Store.Restore(cache.Snapshot{Media: media, UpdatedAt: lastSeen})
+	}
+}
+
+// Reconcile fetches every media item and replaces the cache with the result
+func (s *Syncer) Reconcile() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reconcileLocked()
+}
+
+func (s *Syncer) reconcileLocked() error {
+	media, err := s.Service.FetchMedia()
+	if err != nil {
+		return err
+	}
+
+	// An empty result for a populated cache is far more likely to be an API
+	// hiccup than every post being deleted, so keep what we have.
+	if len(media) == 0 && s.Store.Len() > 0 {
+		logger.Warn("full fetch returned no media, keeping cached items")
+		s.lastReconcile = time.Now()
+		return nil
+	}
+
+	removed := s.Store.ReplaceMedia(media)
+	s.lastReconcile = time.Now()
+	logger.Info("reconciled media", "count", len(media), "removed", len(removed))
+
+	s.archiveUpsert(media)
+	s.archiveDelete(removed)
+	return nil
+}
+
+func (s *Syncer) incrementalLocked() error {
+	newest, ok := s.Store.Newest()
+	if !ok {
+		return s.reconcileLocked()
+	}
+
+	fresh, err := s.Service.FetchMediaUntil(func(m instagram.Media) bool {
+		if known, _ := s.Store.HasMedia([]string{m.ID}); known {
+			return true
+		}
+		return m.Timestamp < newest.Timestamp
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(fresh) == 0 {
+		logger.Info("no new media since last sync")
+		return nil
+	}
+
+	s.Store.SetMedia(fresh)
+	logger.Info("added new media", "count", len(fresh))
+	s.archiveUpsert(fresh)
+	return nil
+}
+
+// UpsertMedia refetches a single media item and stores it, or removes it if
+// Instagram no longer has it. Webhook events use this to apply one change.
+func (s *Syncer) UpsertMedia(id string) error {
+	media, err := s.Service.FetchMediaByID(id)
+	if errors.Is(err, instagram.ErrMediaNotFound) {
+		s.DeleteMedia(id)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	s.Store.SetMedia([]instagram.Media{media})
+	s.archiveUpsert([]instagram.Media{media})
+	return nil
+}
+
+// DeleteMedia removes media that was deleted on Instagram
+func (s *Syncer) DeleteMedia(ids ...string) {
+	s.Store.DeleteMedia(ids...)
+	s.archiveDelete(ids)
+}
+
+func (s *Syncer) archiveUpsert(media []instagram.Media) {
+	if s.Archive == nil || len(media) == 0 {
+		return
+	}
+	if err := s.Archive.Upsert(media); err != nil {
+		logger.Error("failed to archive media", "count", len(media), logging.Err(err))
+	}
+}
+
+func (s *Syncer) archiveDelete(ids []string) {
+	if s.Archive == nil || len(ids) == 0 {
+		return
+	}
+	if err := s.Archive.MarkDeleted(ids); err != nil {
+		logger.Error("failed to mark archived media deleted", "count", len(ids), logging.Err(err))
+	}
+}
+
+// RefreshMissing is called when a request asks for media IDs that are not
+// cached. Each unknown ID is fetched directly, so posts older than the newest
+// cached one are found too. Concurrent callers asking for the same ID share
+// one lookup, lookups are capped per MinRefreshInterval, and IDs Instagram
+// does not have are not looked up again until NegativeTTL has passed.
+func (s *Syncer) RefreshMissing(ids []string) {
+	s.flightMu.Lock()
+	var (
+		mine  []string
+		waits []*flight
+	)
+	for _, id := range s.filterKnownMissingLocked(ids) {
+		if f, ok := s.flights[id]; ok {
+			waits = append(waits, f)
+		} else {
+			mine = append(mine, id)
+		}
+	}
+	mine = s.takeLookupsLocked(mine)
+	f := &flight{done: make(chan struct{})}
+	if s.flights == nil {
+		s.flights = make(map[string]*flight)
+	}
+	for _, id := range mine {
+		s.flights[id] = f
+	}
+	s.flightMu.Unlock()
+
+	if len(mine) > 0 {
+		s.lookup(mine)
+
+		s.flightMu.Lock()
+		for _, id := range mine {
+			delete(s.flights, id)
+		}
+		s.flightMu.Unlock()
+		close(f.done)
+	}
+
+	for _, w := range waits {
+		<-w.done
+	}
+}
+
+// lookup fetches ids one by one, caches what Instagram returns and
+// remembers the IDs it does not have
+func (s *Syncer) lookup(ids []string) {
+	var (
+		found   []instagram.Media
+		missing []string
+	)
+	for _, id := range ids {
+		media, err := s.Service.FetchMediaByID(id)
+		switch {
+		case errors.Is(err, instagram.ErrMediaNotFound):
+			missing = append(missing, id)
+		case err != nil:
+			logger.Error("lookup for missing media failed", "id", id, logging.Err(err))
+		default:
+			found = append(found, media)
+		}
+	}
+
+	if len(found) > 0 {
+		s.Store.SetMedia(found)
+		s.archiveUpsert(found)
+	}
+	if len(missing) > 0 {
+		s.markMissing(missing)
+	}
+}
+
+// takeLookupsLocked returns the leading ids that fit in the current
+// window's lookup budget. Callers must hold s.flightMu.
+func (s *Syncer) takeLookupsLocked(ids []string) []string {
+	window := s.MinRefreshInterval
+	if window == 0 {
+		window = defaultMinRefreshInterval
+	}
+	if time.Since(s.windowStart) >= window {
+		s.windowStart = time.Now()
+		s.lookups = 0
+	}
+
+	n := min(len(ids), maxLookupsPerInterval-s.lookups)
+	if n < len(ids) {
+		logger.Info("skipping lookup for missing media, lookup budget used", "ids", ids[n:], "window", window.String())
+	}
+	s.lookups += n
+	return ids[:n]
+}
+
+// filterKnownMissingLocked drops IDs that are in the negative cache and
+// prunes expired entries. Callers must hold s.flightMu.
+func (s *Syncer) filterKnownMissingLocked(ids []string) []string {
+	now := time.Now()
+	unknown := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if until, ok := s.missing[id]; ok {
+			if now.Before(until) {
+				continue
+			}
+			delete(s.missing, id)
+		}
+		unknown = append(unknown, id)
+	}
+	return unknown
+}
+
+func (s *Syncer) markMissing(ids []string) {
+	ttl := s.NegativeTTL
+	if ttl == 0 {
+		ttl = defaultNegativeTTL
+	}
+
+	s.flightMu.Lock()
+	defer s.flightMu.Unlock()
+	if s.missing == nil {
+		s.missing = make(map[string]time.Time)
+	}
+
+	// Expired entries are otherwise only dropped when the same ID is looked
+	// up again, and made-up IDs never are
+	now := time.Now()
+	for id, until := range s.missing {
+		if !now.Before(until) {
+			delete(s.missing, id)
+		}
+	}
+
+	until := now.Add(ttl)
+	for _, id := range ids {
+		if len(s.missing) >= maxMissing {
+			break
+		}
+		s.missing[id] = until
+	}
+	logger.Info("media not found on Instagram, suppressing refresh", "ids", ids, "ttl", ttl.String())
+}
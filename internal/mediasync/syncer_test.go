@@ -0,0 +1,203 @@
+package mediasync
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"backend-service/internal/cache"
+	"backend-service/internal/instagram"
+	"backend-service/internal/token"
+)
+
+func TestIncrementalSyncStopsAtKnownMedia(t *testing.T) {
+	var page2Calls int32
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/test_user/media", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"data": []map[string]string{
+				{"id": "5", "timestamp": "2026-01-05"},
+				{"id": "4", "timestamp": "2026-01-04"},
+				{"id": "3", "timestamp": "2026-01-03"},
+			},
+			"paging": map[string]string{"next": srv.URL + "/page2"},
+		})
+	})
+	mux.HandleFunc("/page2", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&page2Calls, 1)
+		json.NewEncoder(w).Encode(map[string]any{"data": []map[string]string{}})
+	})
+
+	rt := token.NewRuntime()
+	rt.Set(token.Token{AccessToken: "TEST_TOKEN"})
+
+	store := cache.NewStore()
+	store.SetMedia([]instagram.Media{
+		{ID: "3", Timestamp: "2026-01-03"},
+		{ID: "1", Timestamp: "2026-01-01"},
+	})
+
+	syncer := &Syncer{
+		Store:          store,
+		Service:        &instagram.Service{Client: srv.Client(), BaseURL: srv.URL, IgUserID: "test_user", TokenStore: rt},
+		ReconcileEvery: time.Hour,
+		lastReconcile:  time.Now(),
+	}
+	syncer.Run()
+
+	if store.Len() != 4 {
+		t.Fatalf("expected 4 cached items, got %d", store.Len())
+	}
+	if atomic.LoadInt32(&page2Calls) != 0 {
+		t.Fatal("incremental sync paginated past known media")
+	}
+
+	// A full reconcile drops media that no longer exists on Instagram
+	if err := syncer.Reconcile(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := store.HasMedia([]string{"1"}); ok {
+		t.Fatal("expected media 1 to be removed by reconcile")
+	}
+}
+
+func TestRefreshMissingCoalescesAndRemembersMissingIDs(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/999", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"message":"Unsupported get request.","type":"GraphMethodException","code":100,"error_subcode":33}}`))
+	})
+	// An old post, behind the newest cached one, that an incremental sync
+	// would never reach
+	mux.HandleFunc("/2", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"id": "2", "timestamp": "2025-06-01", "owner": map[string]string{"id": "test_user"}})
+	})
+
+	rt := token.NewRuntime()
+	rt.Set(token.Token{AccessToken: "TEST_TOKEN"})
+
+	store := cache.NewStore()
+	store.SetMedia([]instagram.Media{{ID: "1", Timestamp: "2026-01-01"}})
+
+	syncer := &Syncer{
+		Store:              store,
+		Service:            &instagram.Service{Client: srv.Client(), BaseURL: srv.URL, IgUserID: "test_user", TokenStore: rt},
+		ReconcileEvery:     time.Hour,
+		MinRefreshInterval: time.Nanosecond,
+		lastReconcile:      time.Now(),
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			syncer.RefreshMissing([]string{"999"})
+		}()
+	}
+
+	// Give every caller a chance to join the in-flight lookup
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("expected 1 Graph API call, got %d", got)
+	}
+
+	// The unknown ID is now negatively cached and must not trigger a lookup
+	syncer.RefreshMissing([]string{"999"})
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("expected negative cache to suppress lookup, got %d calls", got)
+	}
+
+	syncer.RefreshMissing([]string{"2"})
+	if ok, _ := store.HasMedia([]string{"2"}); !ok {
+		t.Fatal("expected media older than the newest cached item to be fetched")
+	}
+}
+
+func TestRefreshMissingCapsLookups(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	rt := token.NewRuntime()
+	rt.Set(token.Token{AccessToken: "TEST_TOKEN"})
+	syncer := &Syncer{
+		Store:   cache.NewStore(),
+		Service: &instagram.Service{Client: srv.Client(), BaseURL: srv.URL, IgUserID: "test_user", TokenStore: rt},
+	}
+
+	ids := make([]string, maxLookupsPerInterval+5)
+	for i := range ids {
+		ids[i] = strconv.Itoa(i)
+	}
+	syncer.RefreshMissing(ids)
+	syncer.RefreshMissing([]string{"another"})
+
+	if got := atomic.LoadInt32(&calls); got != maxLookupsPerInterval {
+		t.Fatalf("expected %d Graph API calls, got %d", maxLookupsPerInterval, got)
+	}
+}
+
+func TestMarkMissingPrunesExpiredIDs(t *testing.T) {
+	syncer := &Syncer{NegativeTTL: time.Millisecond}
+	syncer.markMissing([]string{"made-up-1", "made-up-2"})
+	time.Sleep(5 * time.Millisecond)
+
+	syncer.NegativeTTL = time.Minute
+	syncer.markMissing([]string{"made-up-3"})
+
+	if len(syncer.missing) != 1 {
+		t.Fatalf("expected expired IDs to be pruned, got %v", syncer.missing)
+	}
+}
+
+type fakeArchive struct{ media []instagram.Media }
+
+func (f *fakeArchive) Upsert(media []instagram.Media) error { return nil }
+func (f *fakeArchive) MarkDeleted(ids []string) error       { return nil }
+func (f *fakeArchive) LoadActive() ([]instagram.Media, time.Time, error) {
+	return f.media, time.Now(), nil
+}
+
+func TestFailedSyncFallsBackToArchive(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	rt := token.NewRuntime()
+	rt.Set(token.Token{AccessToken: "TEST_TOKEN"})
+	store := cache.NewStore()
+	syncer := &Syncer{
+		Store:          store,
+		Service:        &instagram.Service{Client: srv.Client(), BaseURL: srv.URL, IgUserID: "test_user", TokenStore: rt},
+		Archive:        &fakeArchive{media: []instagram.Media{{ID: "1", Timestamp: "2026-01-01"}}},
+		ReconcileEvery: time.Hour,
+	}
+	syncer.Run()
+
+	if ok, _ := store.HasMedia([]string{"1"}); !ok {
+		t.Fatal("expected the empty cache to be filled from the archive")
+	}
+}
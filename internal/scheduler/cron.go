@@ -2,72 +2,121 @@ package scheduler
 
 import (
 	"context"
-	"log"
-	"os"
-	"strconv"
+	"math/rand/v2"
+	"sync"
 	"time"
+
+	"backend-service/internal/logging"
 )
 
-func mustEnvInt(key string, def int) int {
-	val := os.Getenv(key)
-	if val == "" {
-		return def
-	}
-	i, err := strconv.Atoi(val)
-	if err != nil {
-		log.Fatalf("invalid %s: %v", key, err)
-	}
-	return i
+var logger = logging.Component("scheduler")
+
+// Jobs tracks scheduler goroutines and the runs they start, so shutdown can
+// wait for an in-flight sync or refresh to finish instead of abandoning it
+type Jobs struct {
+	wg sync.WaitGroup
+}
+
+// Go runs fn in a tracked goroutine
+func (j *Jobs) Go(fn func()) {
+	j.wg.Go(fn)
 }
 
-func Start(ctx context.Context, syncFn func(), refTok func()) {
+// Wait blocks until every tracked goroutine has returned or ctx is done.
+// Schedulers only return once the context they were started with is
+// cancelled.
+func (j *Jobs) Wait(ctx context.Context) error {
+	done := make(chan struct{})
 	go func() {
-		dataTicker := time.NewTicker(time.Duration(mustEnvInt("MEDIA_SYNC_TIME", 45)) * time.Minute)
-		tokenTicker := time.NewTicker(time.Duration(mustEnvInt("TOKEN_REFRESH_TIME", 30)) * time.Hour * 24)
+		j.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// StartMediaSync runs syncFn on startup and then every interval, with every
+// run tracked by j
+func (j *Jobs) StartMediaSync(ctx context.Context, every time.Duration, syncFn func()) {
+	j.Go(func() {
+		dataTicker := time.NewTicker(every)
 		defer dataTicker.Stop()
-		defer tokenTicker.Stop()
 
 		// run once on startup
-		go syncFn()
-		go refTok()
+		j.Go(syncFn)
 
 		for {
 			select {
 			case <-ctx.Done():
-				log.Println("[JOB] Stopping scheduler...")
+				logger.Info("stopping scheduler", "job", "media")
 				return
 
 			case <-dataTicker.C:
-				log.Printf("[MEDIA] Syncing media...")
-				go syncFn()
-
-			case <-tokenTicker.C:
-				log.Printf("[TOKEN] Checking token refresh...")
-				go refTok()
+				logger.Info("syncing media", "job", "media")
+				j.Go(syncFn)
 			}
 		}
-	}()
+	})
 }
 
-// StartTokenRefresh starts only the token refresh scheduler (media is fetched on-demand)
-func StartTokenRefresh(ctx context.Context, refTok func()) {
-	go func() {
-		tokenTicker := time.NewTicker(time.Duration(mustEnvInt("TOKEN_REFRESH_TIME", 30)) * time.Hour * 24)
-		defer tokenTicker.Stop()
+// TokenRefresher refreshes the token and knows when the current one next needs refreshing
+type TokenRefresher interface {
+	Refresh() error
+	NextRefresh() time.Time
+}
 
-		// run token refresh once on startup
-		go refTok()
+const (
+	minRefreshRecheck = time.Minute
+	maxRefreshRecheck = 24 * time.Hour
+	baseRetryDelay    = 30 * time.Second
+	maxRetryDelay     = time.Hour
+)
 
+// StartExpiryRefresh refreshes the token once on startup and then again when
+// the token enters its refresh window, instead of on a fixed ticker. Failed
+// refreshes are retried with exponential backoff and jitter. The schedule is
+// re-checked at least daily so tokens changed elsewhere are noticed. A
+// refresh that is running when ctx is cancelled completes before the
+// goroutine returns.
+func (j *Jobs) StartExpiryRefresh(ctx context.Context, r TokenRefresher) {
+	j.Go(func() {
+		failures := 0
 		for {
+			var wait time.Duration
+			if err := r.Refresh(); err != nil {
+				failures++
+				wait = retryDelay(failures)
+				logger.Warn("retrying token refresh", "job", "token", "in", wait.Round(time.Second).String(), "failures", failures)
+			} else {
+				failures = 0
+				wait = min(max(time.Until(r.NextRefresh()), minRefreshRecheck), maxRefreshRecheck)
+				logger.Info("scheduled next token refresh check", "job", "token", "in", wait.Round(time.Second).String())
+			}
+
+			timer := time.NewTimer(wait)
 			select {
 			case <-ctx.Done():
-				log.Println("[JOB] Stopping token refresh scheduler...")
+				timer.Stop()
+				logger.Info("stopping scheduler", "job", "token")
 				return
-
-			case <-tokenTicker.C:
-				log.Printf("[TOKEN] Checking token refresh...")
-				go refTok()
+			case <-timer.C:
 			}
 		}
-	}()
+	})
+}
+
+// retryDelay is an exponential backoff with jitter: the n-th consecutive
+// failure waits a random duration between half and all of base*2^(n-1),
+// capped at maxRetryDelay.
+func retryDelay(failures int) time.Duration {
+	d := maxRetryDelay
+	if failures < 20 {
+		d = min(baseRetryDelay<<(failures-1), maxRetryDelay)
+	}
+	return d/2 + rand.N(d/2+1)
 }
@@ -8,18 +8,96 @@ import (
 )
 
 func TestSchedulerCallsFunctions(t *testing.T) {
-	var refreshCalled int32
+	var syncCalled int32
 
-	refreshFn := func() {
-		atomic.AddInt32(&refreshCalled, 1)
+	syncFn := func() {
+		atomic.AddInt32(&syncCalled, 1)
 	}
 
-	ctx := context.Background()
-	StartTokenRefresh(ctx, refreshFn)
+	ctx, cancel := context.WithCancel(context.Background())
+	var jobs Jobs
+	jobs.StartMediaSync(ctx, 50*time.Millisecond, syncFn)
 
-	time.Sleep(2 * time.Second)
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+	if err := jobs.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once on startup, then on every tick
+	if got := atomic.LoadInt32(&syncCalled); got < 2 {
+		t.Fatalf("expected syncFn on startup and on a tick, got %d calls", got)
+	}
+}
+
+func TestRetryDelayBacksOffWithJitter(t *testing.T) {
+	for failures := 1; failures <= 30; failures++ {
+		d := retryDelay(failures)
+		ceiling := min(baseRetryDelay<<min(failures-1, 20), maxRetryDelay)
+		if d < ceiling/2 || d > ceiling {
+			t.Fatalf("failure %d: delay %v outside [%v, %v]", failures, d, ceiling/2, ceiling)
+		}
+	}
+}
+
+type fakeRefresher struct {
+	calls int32
+}
+
+func (f *fakeRefresher) Refresh() error {
+	atomic.AddInt32(&f.calls, 1)
+	return nil
+}
+
+func (f *fakeRefresher) NextRefresh() time.Time {
+	return time.Now().Add(30 * 24 * time.Hour)
+}
+
+func TestExpiryRefreshRunsOnStartupAndStops(t *testing.T) {
+	r := &fakeRefresher{}
+	ctx, cancel := context.WithCancel(context.Background())
+	var jobs Jobs
+	jobs.StartExpiryRefresh(ctx, r)
 
-	if atomic.LoadInt32(&refreshCalled) == 0 {
-		t.Fatal("refreshFn was not called")
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	if got := atomic.LoadInt32(&r.calls); got != 1 {
+		t.Fatalf("expected 1 refresh on startup, got %d", got)
+	}
+}
+
+type slowRefresher struct {
+	started  chan struct{}
+	finished atomic.Bool
+}
+
+func (s *slowRefresher) Refresh() error {
+	close(s.started)
+	time.Sleep(200 * time.Millisecond)
+	s.finished.Store(true)
+	return nil
+}
+
+func (s *slowRefresher) NextRefresh() time.Time {
+	return time.Now().Add(30 * 24 * time.Hour)
+}
+
+func TestJobsWaitDrainsInFlightRefresh(t *testing.T) {
+	r := &slowRefresher{started: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var jobs Jobs
+	jobs.StartExpiryRefresh(ctx, r)
+	<-r.started
+	cancel()
+
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer waitCancel()
+	if err := jobs.Wait(waitCtx); err != nil {
+		t.Fatalf("expected jobs to drain, got %v", err)
+	}
+	if !r.finished.Load() {
+		t.Fatal("Wait returned before the in-flight refresh finished")
 	}
 }
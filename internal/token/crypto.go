@@ -0,0 +1,238 @@
+package token
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// sealedPrefix marks an access token that was encrypted by a Keyring.
+// Values without it are legacy plaintext tokens.
+const sealedPrefix = "enc:v1:"
+
+// ErrNoKeyring is returned when an encrypted token is read but no keys are configured
+var ErrNoKeyring = errors.New("token is encrypted but no encryption keys are configured")
+
+// Keyring encrypts access tokens at rest with envelope encryption: each value
+// gets a fresh data key, and the data key is wrapped with a named key
+// encryption key. New values use the primary key; older keys stay available
+// for reading so keys can be rotated.
+type Keyring struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyring builds a keyring from 32-byte AES-256 keys. primary names the
+// key used for new values.
+func NewKeyring(primary string, keys map[string][]byte) (*Keyring, error) {
+	k := &Keyring{primary: primary, keys: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid key id %q", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %q must be 32 bytes, got %d", id, len(key))
+		}
+		aead, err := newGCM(key)
+		if err != nil {
+			return nil, err
+		}
+		k.keys[id] = aead
+	}
+	if _, ok := k.keys[primary]; !ok {
+		return nil, fmt.Errorf("primary key %q not found", primary)
+	}
+	return k, nil
+}
+
+// LoadKeyring parses spec, or the contents of the file at path when spec is
+// empty, as comma or newline separated "id:base64key" entries. The first
+// entry is the primary key. It returns nil when neither is set.
+func LoadKeyring(spec, path string) (*Keyring, error) {
+	if spec == "" && path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		spec = string(data)
+	}
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+
+	var primary string
+	keys := make(map[string][]byte)
+	for _, entry := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '\n' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid key entry, expected id:base64key")
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %q is not valid base64: %w", id, err)
+		}
+		if primary == "" {
+			primary = id
+		}
+		keys[id] = key
+	}
+	return NewKeyring(primary, keys)
+}
+
+// Seal encrypts plaintext under a new data key wrapped by the primary key
+func (k *Keyring) Seal(plaintext string) (string, error) {
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+	data, err := newGCM(dek)
+	if err != nil {
+		return "", err
+	}
+
+	aad := []byte(k.primary)
+	wrapped, err := seal(k.keys[k.primary], dek, aad)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(data, []byte(plaintext), aad)
+	if err != nil {
+		return "", err
+	}
+
+	return sealedPrefix + k.primary + ":" +
+		base64.RawStdEncoding.EncodeToString(wrapped) + ":" +
+		base64.RawStdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Open decrypts a value produced by Seal. current reports whether it was
+// sealed with the primary key; values under a rotated-out key should be
+// rewritten.
+func (k *Keyring) Open(value string) (plaintext string, current bool, err error) {
+	rest, ok := strings.CutPrefix(value, sealedPrefix)
+	if !ok {
+		return "", false, errors.New("value is not sealed")
+	}
+	parts := strings.Split(rest, ":")
+	if len(parts) != 3 {
+		return "", false, errors.New("malformed sealed token")
+	}
+	id := parts[0]
+
+	kek, ok := k.keys[id]
+	if !ok {
+		return "", false, fmt.Errorf("token sealed with unknown key %q", id)
+	}
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", false, err
+	}
+	ciphertext, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", false, err
+	}
+
+	aad := []byte(id)
+	dek, err := open(kek, wrapped, aad)
+	if err != nil {
+		return "", false, fmt.Errorf("unwrap data key: %w", err)
+	}
+	data, err := newGCM(dek)
+	if err != nil {
+		return "", false, err
+	}
+	plain, err := open(data, ciphertext, aad)
+	if err != nil {
+		return "", false, fmt.Errorf("decrypt token: %w", err)
+	}
+	return string(plain), id == k.primary, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(aead cipher.AEAD, sealed, aad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, aad)
+}
+
+var (
+	keyringMu sync.RWMutex
+	keyring   *Keyring
+)
+
+// UseKeyring makes every persistence layer encrypt tokens with k. A nil
+// keyring stores tokens in plaintext.
+func UseKeyring(k *Keyring) {
+	keyringMu.Lock()
+	defer keyringMu.Unlock()
+	keyring = k
+}
+
+func currentKeyring() *Keyring {
+	keyringMu.RLock()
+	defer keyringMu.RUnlock()
+	return keyring
+}
+
+// sealToken returns t with its access token encrypted for storage
+func sealToken(t Token) (Token, error) {
+	k := currentKeyring()
+	if k == nil {
+		return t, nil
+	}
+	sealed, err := k.Seal(t.AccessToken)
+	if err != nil {
+		return Token{}, err
+	}
+	t.AccessToken = sealed
+	return t, nil
+}
+
+// openToken decrypts a stored token in place. Plaintext tokens written before
+// encryption was enabled, and tokens sealed with a rotated-out key, are
+// flagged so NeedsMigration reports true.
+func openToken(t *Token) error {
+	k := currentKeyring()
+	if !strings.HasPrefix(t.AccessToken, sealedPrefix) {
+		t.legacy = k != nil
+		return nil
+	}
+	if k == nil {
+		return ErrNoKeyring
+	}
+
+	plain, current, err := k.Open(t.AccessToken)
+	if err != nil {
+		return err
+	}
+	t.AccessToken = plain
+	t.legacy = !current
+	return nil
+}
@@ -0,0 +1,75 @@
+package token
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testKeyring(t *testing.T, primary string, ids ...string) *Keyring {
+	t.Helper()
+	keys := make(map[string][]byte)
+	for i, id := range ids {
+		keys[id] = bytes.Repeat([]byte{byte(i + 1)}, 32)
+	}
+	k, err := NewKeyring(primary, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestDiskTokenIsEncryptedAtRest(t *testing.T) {
+	UseKeyring(testKeyring(t, "k1", "k1"))
+	t.Cleanup(func() { UseKeyring(nil) })
+
+	path := filepath.Join(t.TempDir(), "token.json")
+	if err := SaveToDisk(path, &Token{AccessToken: "SECRET_TOKEN", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "SECRET_TOKEN") {
+		t.Fatal("token written to disk in plaintext")
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Fatalf("expected mode 0600, got %v", info.Mode().Perm())
+	}
+
+	loaded, err := LoadFromDisk(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.AccessToken != "SECRET_TOKEN" || loaded.NeedsMigration() {
+		t.Fatalf("unexpected loaded token %+v", loaded)
+	}
+}
+
+func TestLegacyAndRotatedTokensNeedMigration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	t.Cleanup(func() { UseKeyring(nil) })
+
+	// Written before encryption was enabled
+	UseKeyring(nil)
+	SaveToDisk(path, &Token{AccessToken: "PLAIN", ExpiresAt: time.Now().Add(time.Hour)})
+
+	UseKeyring(testKeyring(t, "k1", "k1"))
+	loaded, err := LoadFromDisk(path)
+	if err != nil || loaded.AccessToken != "PLAIN" || !loaded.NeedsMigration() {
+		t.Fatalf("expected readable legacy token needing migration, got %+v, %v", loaded, err)
+	}
+
+	// Sealed under k1, then k2 becomes primary
+	SaveToDisk(path, loaded)
+	UseKeyring(testKeyring(t, "k2", "k1", "k2"))
+	loaded, err = LoadFromDisk(path)
+	if err != nil || loaded.AccessToken != "PLAIN" || !loaded.NeedsMigration() {
+		t.Fatalf("expected token under rotated key to need migration, got %+v, %v", loaded, err)
+	}
+}
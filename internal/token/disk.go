@@ -18,15 +18,42 @@ func LoadFromDisk(path string) (*Token, error) {
 	}
 
 	var token Token
-	err = json.Unmarshal(data, &token)
-	return &token, err
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, err
+	}
+	if err := openToken(&token); err != nil {
+		return nil, err
+	}
+	return &token, nil
 }
 
 func SaveToDisk(path string, token *Token) error {
-	data, err := json.MarshalIndent(token, "", "  ")
+	sealed, err := sealToken(*token)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(sealed, "", "  ")
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(path, data, 0644) // rw-r--r--
+	if err := os.WriteFile(path, data, 0600); err != nil { // rw-------
+		return err
+	}
+	// WriteFile keeps the mode of an existing file, so tighten older token files
+	return os.Chmod(path, 0600)
+}
+
+// DiskSource persists the token as JSON at Path
+type DiskSource struct {
+	Path string
 }
+
+func NewDiskSource(path string) *DiskSource {
+	return &DiskSource{Path: path}
+}
+
+func (d *DiskSource) Name() string          { return "disk" }
+func (d *DiskSource) Load() (*Token, error) { return LoadFromDisk(d.Path) }
+func (d *DiskSource) Save(t Token) error    { return SaveToDisk(d.Path, &t) }
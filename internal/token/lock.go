@@ -0,0 +1,194 @@
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"backend-service/internal/logging"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var logger = logging.Component("token")
+
+// ErrFenced is returned when a write is rejected because a newer lease holder
+// has already written
+var ErrFenced = errors.New("token write rejected by newer refresh lease")
+
+// lockKey wraps the token key in a hash tag so the lock and fence land in
+// the token's cluster slot, which fencedSetScript needs. A key that already
+// has a hash tag is used as it is.
+func lockKey(tokenKey string) string {
+	if !strings.Contains(tokenKey, "{") {
+		tokenKey = "{" + tokenKey + "}"
+	}
+	return tokenKey + ":refresh_lock"
+}
+func fenceKey(tokenKey string) string { return lockKey(tokenKey) + ":fence" }
+func updateChannel(tokenKey string) string {
+	return tokenKey + ":updates"
+}
+
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// fencedSetScript writes the token only if no lease with a higher fence has
+// been granted since ours
+var fencedSetScript = redis.NewScript(`
+local current = tonumber(redis.call('GET', KEYS[2]) or '0')
+if current > tonumber(ARGV[2]) then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[3])
+else
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+// RedisLock is a lease that ensures only one replica refreshes the token at
+// a time. Each acquisition is issued an increasing fence number so writes
+// from a holder whose lease has lapsed can be rejected.
+type RedisLock struct {
+	client redis.UniversalClient
+	key    string
+	ttl    time.Duration
+	owner  string
+}
+
+// Lease is a held RedisLock
+type Lease struct {
+	lock  *RedisLock
+	value string
+	Fence int64
+}
+
+// NewRedisLockFor guards the token stored under key
+func NewRedisLockFor(client redis.UniversalClient, key string, ttl time.Duration) *RedisLock {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return &RedisLock{client: client, key: key, ttl: ttl, owner: hex.EncodeToString(id)}
+}
+
+// Acquire takes the lease if nobody holds it. It returns nil without an
+// error when another instance holds the lease.
+func (l *RedisLock) Acquire() (*Lease, error) {
+	value := l.owner + ":" + time.Now().Format(time.RFC3339Nano)
+	ok, err := l.client.SetNX(ctx, lockKey(l.key), value, l.ttl).Result()
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	// Only the holder increments the fence, so fences follow acquisition order
+	lease := &Lease{lock: l, value: value}
+	lease.Fence, err = l.client.Incr(ctx, fenceKey(l.key)).Result()
+	if err != nil {
+		lease.Release()
+		return nil, err
+	}
+	return lease, nil
+}
+
+// Release gives up the lease if it is still ours
+func (l *Lease) Release() error {
+	return releaseScript.Run(ctx, l.lock.client, []string{lockKey(l.lock.key)}, l.value).Err()
+}
+
+// Save writes t to Redis under the lease's fence and notifies other
+// instances that a new token is available
+func (l *Lease) Save(t Token) error {
+	if err := saveToRedisFenced(l.lock.client, l.lock.key, t, l.Fence); err != nil {
+		return err
+	}
+	return l.lock.client.Publish(ctx, updateChannel(l.lock.key), l.lock.owner).Err()
+}
+
+// saveToRedisFenced is saveToRedis that fails with ErrFenced when a lease
+// with a higher fence than the given one has been granted
+func saveToRedisFenced(client redis.UniversalClient, key string, t Token, fence int64) error {
+	sealed, err := sealToken(t)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(sealed)
+	if err != nil {
+		return err
+	}
+
+	ttl := time.Until(t.ExpiresAt)
+	if ttl < 0 {
+		ttl = 0
+	}
+
+	ok, err := fencedSetScript.Run(ctx, client,
+		[]string{key, fenceKey(key)},
+		data, fence, ttl.Milliseconds(),
+	).Int()
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		return ErrFenced
+	}
+	return nil
+}
+
+// reloadEvery is how often WatchRedisFor reads the token sources in case an
+// update notification was missed, such as while Redis was unreachable
+const reloadEvery = 5 * time.Minute
+
+// WatchRedisFor keeps runtime in sync with the token stored under key as
+// other instances refresh it. Update notifications are picked up at once, and
+// chain is reloaded every few minutes so a missed notification only delays
+// the new token. It returns when ctx is cancelled.
+func WatchRedisFor(ctx context.Context, client redis.UniversalClient, key string, runtime *TokenRuntime, chain Chain) {
+	sub := client.Subscribe(ctx, updateChannel(key))
+	defer sub.Close()
+
+	reload := time.NewTicker(reloadEvery)
+	defer reload.Stop()
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+
+			t, err := loadFromRedis(client, key)
+			if err != nil {
+				logger.Error("failed to load token after update notification", logging.Err(err))
+				continue
+			}
+			adopt(runtime, LoadResult{Source: "redis", Token: t})
+
+		case <-reload.C:
+			if best, ok := Freshest(chain.LoadAll()); ok {
+				adopt(runtime, best)
+			}
+		}
+	}
+}
+
+// adopt sets runtime to the loaded token if it outlasts the current one
+func adopt(runtime *TokenRuntime, loaded LoadResult) {
+	if loaded.Token.ExpiresAt.After(runtime.Token().ExpiresAt) {
+		runtime.SetFrom(*loaded.Token, loaded.Source)
+		logger.Info("picked up token refreshed by another instance", "source", loaded.Source, "expires_at", loaded.Token.ExpiresAt)
+	}
+}
@@ -4,31 +4,55 @@ import (
 	"database/sql"
 )
 
-func LoadFromDB(db *sql.DB) (*Token, error) {
+// LoadFromDB reads the token stored for account
+func LoadFromDB(db *sql.DB, account string) (*Token, error) {
 	row := db.QueryRow(`
 		SELECT access_token, expires_at
 		FROM instagram_tokens
-		WHERE id = TRUE
-	`)
+		WHERE account = $1
+	`, account)
 
 	var t Token
 	err := row.Scan(&t.AccessToken, &t.ExpiresAt)
 	if err != nil {
 		return nil, err
 	}
+	if err := openToken(&t); err != nil {
+		return nil, err
+	}
 	return &t, nil
 }
 
-func SaveToDB(db *sql.DB, t Token) error {
-	_, err := db.Exec(`
-		INSERT INTO instagram_tokens (id, access_token, expires_at)
-		VALUES (TRUE, $1, $2)
-		ON CONFLICT (id)
+// SaveToDB stores t as the token for account
+func SaveToDB(db *sql.DB, account string, t Token) error {
+	t, err := sealToken(t)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO instagram_tokens (account, access_token, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (account)
 		DO UPDATE SET
 			access_token = EXCLUDED.access_token,
 			expires_at = EXCLUDED.expires_at,
 			updated_at = now()
-	`, t.AccessToken, t.ExpiresAt)
+	`, account, t.AccessToken, t.ExpiresAt)
 
 	return err
 }
+
+// PostgresSource persists an account's token in its instagram_tokens row
+type PostgresSource struct {
+	db      *sql.DB
+	account string
+}
+
+func NewPostgresSource(db *sql.DB, account string) *PostgresSource {
+	return &PostgresSource{db: db, account: account}
+}
+
+func (p *PostgresSource) Name() string          { return "postgres" }
+func (p *PostgresSource) Load() (*Token, error) { return LoadFromDB(p.db, p.account) }
+func (p *PostgresSource) Save(t Token) error    { return SaveToDB(p.db, p.account, t) }
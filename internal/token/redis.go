@@ -3,7 +3,6 @@ package token
 import (
 	"context"
 	"encoding/json"
-	"os"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -11,15 +10,27 @@ import (
 
 var ctx = context.Background()
 
-func getTokenKey() string {
-	if key := os.Getenv("REDIS_TOKEN_KEY"); key != "" {
-		return key
+var redisKey = "instagram_token"
+
+// UseRedisKey sets the key tokens are stored under in Redis. The refresh lock,
+// fence and update channel are derived from it. Call it before any token is
+// read or written.
+func UseRedisKey(key string) {
+	if key != "" {
+		redisKey = key
 	}
-	return "instagram_token"
 }
 
-func LoadFromRedis(client *redis.Client) (*Token, error) {
-	val, err := client.Get(ctx, getTokenKey()).Result()
+func getTokenKey() string {
+	return redisKey
+}
+
+func LoadFromRedis(client redis.UniversalClient) (*Token, error) {
+	return loadFromRedis(client, getTokenKey())
+}
+
+func loadFromRedis(client redis.UniversalClient, key string) (*Token, error) {
+	val, err := client.Get(ctx, key).Result()
 	if err != nil {
 		return nil, err
 	}
@@ -28,12 +39,24 @@ func LoadFromRedis(client *redis.Client) (*Token, error) {
 	if err := json.Unmarshal([]byte(val), &t); err != nil {
 		return nil, err
 	}
+	if err := openToken(&t); err != nil {
+		return nil, err
+	}
 
 	return &t, nil
 }
 
-func SaveToRedis(client *redis.Client, t Token) error {
-	data, err := json.Marshal(t)
+func SaveToRedis(client redis.UniversalClient, t Token) error {
+	return saveToRedis(client, getTokenKey(), t)
+}
+
+func saveToRedis(client redis.UniversalClient, key string, t Token) error {
+	sealed, err := sealToken(t)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(sealed)
 	if err != nil {
 		return err
 	}
@@ -44,5 +67,20 @@ func SaveToRedis(client *redis.Client, t Token) error {
 		ttl = 0
 	}
 
-	return client.Set(ctx, getTokenKey(), data, ttl).Err()
+	return client.Set(ctx, key, data, ttl).Err()
 }
+
+// RedisSource persists the token under a Redis key
+type RedisSource struct {
+	client redis.UniversalClient
+	key    string
+}
+
+// NewRedisSourceFor stores the token under key
+func NewRedisSourceFor(client redis.UniversalClient, key string) *RedisSource {
+	return &RedisSource{client: client, key: key}
+}
+
+func (r *RedisSource) Name() string          { return "redis" }
+func (r *RedisSource) Load() (*Token, error) { return loadFromRedis(r.client, r.key) }
+func (r *RedisSource) Save(t Token) error    { return saveToRedis(r.client, r.key, t) }
@@ -1,18 +1,32 @@
 package token
 
 import (
+	"fmt"
 	"sync"
 	"time"
+
+	"backend-service/internal/logging"
 )
 
 type Token struct {
 	AccessToken string
 	ExpiresAt   time.Time
+
+	// legacy is set when the stored form is plaintext or sealed with a
+	// rotated-out key and should be rewritten
+	legacy bool
+}
+
+// NeedsMigration reports whether the token was stored in plaintext or under
+// an old encryption key and should be saved again
+func (t Token) NeedsMigration() bool {
+	return t.legacy
 }
 
 type TokenRuntime struct {
-	mu    sync.RWMutex
-	token Token
+	mu     sync.RWMutex
+	token  Token
+	source string
 }
 
 func NewRuntime() *TokenRuntime {
@@ -25,17 +39,41 @@ func (s *TokenRuntime) Get() string {
 	return s.token.AccessToken
 }
 
+// Token returns a copy of the current token including its expiry
+func (s *TokenRuntime) Token() Token {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.token
+}
+
 func (s *TokenRuntime) Set(token Token) {
+	s.SetFrom(token, "")
+}
+
+// SetFrom sets the token and records where it came from. The token replaces
+// this runtime's previous one in the log redaction list.
+func (s *TokenRuntime) SetFrom(token Token, source string) {
+	logging.SetSecret(fmt.Sprintf("access_token@%p", s), token.AccessToken)
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.token = token
+	s.source = source
+}
+
+// Source returns where the current token came from, if known
+func (s *TokenRuntime) Source() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.source
 }
 
-func (s *TokenRuntime) IsValid() bool {
+// NeedsRefresh reports whether there is a token and it expires within window
+func (s *TokenRuntime) NeedsRefresh(window time.Duration) bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	if s.token.AccessToken == "" {
 		return false
 	}
-	return time.Until(s.token.ExpiresAt) < 7*24*time.Hour
+	return time.Until(s.token.ExpiresAt) < window
 }
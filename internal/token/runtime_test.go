@@ -28,7 +28,7 @@ func TestTokenExpiresSoon(t *testing.T) {
 		ExpiresAt:   time.Now().Add(3 * 24 * time.Hour),
 	})
 
-	if !rt.IsValid() {
+	if !rt.NeedsRefresh(7 * 24 * time.Hour) {
 		t.Fatal("expected token to expire soon")
 	}
 }
@@ -41,7 +41,7 @@ func TestTokenNotExpiringSoon(t *testing.T) {
 		ExpiresAt:   time.Now().Add(30 * 24 * time.Hour),
 	})
 
-	if rt.IsValid() {
+	if rt.NeedsRefresh(7 * 24 * time.Hour) {
 		t.Fatal("token should not be expiring soon")
 	}
 }
@@ -0,0 +1,117 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Source is a place where the access token is persisted
+type Source interface {
+	Name() string
+	Load() (*Token, error)
+	Save(t Token) error
+}
+
+// SourceError ties an error to the source that produced it
+type SourceError struct {
+	Source string
+	Err    error
+}
+
+func (e *SourceError) Error() string {
+	return e.Source + ": " + e.Err.Error()
+}
+
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// LoadResult is the outcome of loading the token from one source
+type LoadResult struct {
+	Source string
+	Token  *Token
+	Err    error
+}
+
+// Chain is an ordered list of token sources. Order breaks ties between
+// sources holding tokens with the same expiry.
+type Chain []Source
+
+// NewChain orders the available sources by name. Names without a matching
+// source are reported in the returned error; the chain still contains every
+// source that was found.
+func NewChain(order []string, available ...Source) (Chain, error) {
+	byName := make(map[string]Source, len(available))
+	for _, s := range available {
+		byName[s.Name()] = s
+	}
+
+	var (
+		chain Chain
+		errs  []error
+	)
+	for _, name := range order {
+		s, ok := byName[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("token source %q is not available", name))
+			continue
+		}
+		chain = append(chain, s)
+	}
+	return chain, errors.Join(errs...)
+}
+
+// Without returns the chain minus the source with the given name
+func (c Chain) Without(name string) Chain {
+	out := make(Chain, 0, len(c))
+	for _, s := range c {
+		if s.Name() != name {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// LoadAll loads the token from every source in order
+func (c Chain) LoadAll() []LoadResult {
+	results := make([]LoadResult, 0, len(c))
+	for _, s := range c {
+		t, err := s.Load()
+		results = append(results, LoadResult{Source: s.Name(), Token: t, Err: err})
+	}
+	return results
+}
+
+// SaveAll writes t to every source. Failures are returned as joined
+// *SourceError values so callers can see which sources are out of date.
+func (c Chain) SaveAll(t Token) error {
+	var errs []error
+	for _, s := range c {
+		if err := s.Save(t); err != nil {
+			errs = append(errs, &SourceError{Source: s.Name(), Err: err})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Freshest returns the unexpired token with the latest expiry. The first
+// source wins when expiries are equal.
+func Freshest(results []LoadResult) (LoadResult, bool) {
+	var (
+		best  LoadResult
+		found bool
+	)
+	for _, r := range results {
+		if r.Err != nil || r.Token == nil || r.Token.AccessToken == "" {
+			continue
+		}
+		if !time.Now().Before(r.Token.ExpiresAt) {
+			continue
+		}
+		if !found || r.Token.ExpiresAt.After(best.Token.ExpiresAt) {
+			best, found = r, true
+		}
+	}
+	return best, found
+}
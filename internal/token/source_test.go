@@ -0,0 +1,63 @@
+package token
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type failingSource struct{}
+
+func (failingSource) Name() string          { return "failing" }
+func (failingSource) Load() (*Token, error) { return nil, errors.New("unavailable") }
+func (failingSource) Save(Token) error      { return errors.New("unavailable") }
+
+func TestChainPicksFreshestToken(t *testing.T) {
+	dir := t.TempDir()
+	older := NewDiskSource(filepath.Join(dir, "older.json"))
+	newer := NewDiskSource(filepath.Join(dir, "newer.json"))
+	expired := NewDiskSource(filepath.Join(dir, "expired.json"))
+
+	older.Save(Token{AccessToken: "OLDER", ExpiresAt: time.Now().Add(time.Hour)})
+	newer.Save(Token{AccessToken: "NEWER", ExpiresAt: time.Now().Add(48 * time.Hour)})
+	expired.Save(Token{AccessToken: "EXPIRED", ExpiresAt: time.Now().Add(-time.Hour)})
+
+	chain := Chain{older, failingSource{}, expired, newer}
+	best, ok := Freshest(chain.LoadAll())
+	if !ok {
+		t.Fatal("expected a valid token")
+	}
+	if best.Token.AccessToken != "NEWER" {
+		t.Fatalf("expected NEWER, got %s", best.Token.AccessToken)
+	}
+}
+
+func TestChainSaveAllReportsFailingSources(t *testing.T) {
+	disk := NewDiskSource(filepath.Join(t.TempDir(), "token.json"))
+	chain := Chain{disk, failingSource{}}
+
+	err := chain.SaveAll(Token{AccessToken: "SAVED", ExpiresAt: time.Now().Add(time.Hour)})
+
+	var srcErr *SourceError
+	if !errors.As(err, &srcErr) || srcErr.Source != "failing" {
+		t.Fatalf("expected SourceError for failing source, got %v", err)
+	}
+
+	loaded, err := disk.Load()
+	if err != nil || loaded.AccessToken != "SAVED" {
+		t.Fatalf("expected disk source to be written despite other failures, got %v, %v", loaded, err)
+	}
+}
+
+func TestNewChainOrdersAndReportsMissingSources(t *testing.T) {
+	disk := NewDiskSource("unused.json")
+
+	chain, err := NewChain([]string{"postgres", "disk"}, disk)
+	if err == nil {
+		t.Fatal("expected error for unavailable postgres source")
+	}
+	if len(chain) != 1 || chain[0].Name() != "disk" {
+		t.Fatalf("expected chain with disk only, got %v", chain)
+	}
+}
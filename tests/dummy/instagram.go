@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/rand"
+	"net"
 	"net/http"
+	"time"
 )
 
 func StartDummyServer() *http.Server {
@@ -93,5 +95,15 @@ func StartDummyServer() *http.Server {
 
 	go srv.ListenAndServe()
 
+	// Wait until the server accepts connections so callers can make requests
+	// straight away
+	for range 100 {
+		if conn, err := net.Dial("tcp", "localhost"+srv.Addr); err == nil {
+			conn.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
 	return srv
 }
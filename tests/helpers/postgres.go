@@ -24,7 +24,7 @@ func SetupTestDB(t *testing.T) *sql.DB {
 	// ensure table exists
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS instagram_tokens (
-			id BOOLEAN PRIMARY KEY DEFAULT TRUE,
+			account TEXT PRIMARY KEY DEFAULT 'default',
 			access_token TEXT NOT NULL,
 			expires_at TIMESTAMPTZ NOT NULL,
 			updated_at TIMESTAMPTZ DEFAULT now()
@@ -34,8 +34,50 @@ func SetupTestDB(t *testing.T) *sql.DB {
 		t.Fatal(err)
 	}
 
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS instagram_media (
+			account TEXT NOT NULL DEFAULT 'default',
+			id TEXT NOT NULL,
+			caption TEXT NOT NULL DEFAULT '',
+			media_type TEXT NOT NULL DEFAULT '',
+			media_url TEXT NOT NULL DEFAULT '',
+			thumbnail_url TEXT NOT NULL DEFAULT '',
+			permalink TEXT NOT NULL DEFAULT '',
+			posted_at TIMESTAMPTZ,
+			username TEXT NOT NULL DEFAULT '',
+			like_count INTEGER NOT NULL DEFAULT 0,
+			comments_count INTEGER NOT NULL DEFAULT 0,
+			is_shared_to_feed BOOLEAN NOT NULL DEFAULT FALSE,
+			children JSONB,
+			first_seen TIMESTAMPTZ NOT NULL DEFAULT now(),
+			last_seen TIMESTAMPTZ NOT NULL DEFAULT now(),
+			deleted_at TIMESTAMPTZ,
+			PRIMARY KEY (account, id)
+		);
+		CREATE TABLE IF NOT EXISTS instagram_media_captions (
+			id BIGSERIAL PRIMARY KEY,
+			account TEXT NOT NULL DEFAULT 'default',
+			media_id TEXT NOT NULL,
+			caption TEXT NOT NULL,
+			recorded_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			FOREIGN KEY (account, media_id) REFERENCES instagram_media (account, id) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// upgrade tables created before accounts were added
+	migration, err := os.ReadFile("../../database/migrate_accounts.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(string(migration)); err != nil {
+		t.Fatal(err)
+	}
+
 	// clean state before each test
-	_, err = db.Exec(`DELETE FROM instagram_tokens`)
+	_, err = db.Exec(`DELETE FROM instagram_tokens; DELETE FROM instagram_media`)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -5,40 +5,25 @@ import (
 	"os"
 	"testing"
 
+	"backend-service/internal/config"
+
 	"github.com/redis/go-redis/v9"
 )
 
 var ctx = context.Background()
 
-func SetupTestRedis(t *testing.T) *redis.Client {
+func SetupTestRedis(t *testing.T) redis.UniversalClient {
 	t.Helper()
 
-	redisURL := os.Getenv("UPSTASH_REDIS_REST_URL")
-	redisToken := os.Getenv("UPSTASH_REDIS_REST_TOKEN")
-
-	if redisURL == "" || redisToken == "" {
-		t.Fatal("UPSTASH_REDIS_REST_URL or UPSTASH_REDIS_REST_TOKEN not set")
-	}
-
-	// Convert https:// to rediss:// for Upstash
-	if len(redisURL) > 8 && redisURL[:8] == "https://" {
-		redisURL = "rediss://" + redisURL[8:]
-	}
-
-	// Parse the URL with token
-	opt, err := redis.ParseURL(redisURL)
+	// REDIS_URL takes precedence over the legacy Upstash settings
+	client, err := config.ConnectRedis(config.Config{
+		RedisURL:     os.Getenv("REDIS_URL"),
+		RedisMode:    config.RedisSingle,
+		UpstashURL:   os.Getenv("UPSTASH_REDIS_REST_URL"),
+		UpstashToken: os.Getenv("UPSTASH_REDIS_REST_TOKEN"),
+	})
 	if err != nil {
-		t.Fatal(err)
-	}
-
-	// Set the password from token
-	opt.Password = redisToken
-
-	client := redis.NewClient(opt)
-
-	// Test connection
-	if err := client.Ping(ctx).Err(); err != nil {
-		t.Fatalf("failed to connect to Redis: %v", err)
+		t.Fatalf("failed to connect to Redis (set REDIS_URL or UPSTASH_REDIS_REST_URL): %v", err)
 	}
 
 	// Use test-specific key from environment to avoid affecting production
@@ -2,12 +2,14 @@ package helpers
 
 import (
 	"net/http"
-	"os"
 
 	"backend-service/internal/instagram"
 	"backend-service/internal/token"
 )
 
+// DummyBaseURL is where tests/dummy serves the Graph API
+const DummyBaseURL = "http://localhost:9090"
+
 func NewTestService(igUserID string) *instagram.Service {
 	rt := token.NewRuntime()
 
@@ -19,10 +21,9 @@ func NewTestService(igUserID string) *instagram.Service {
 	client := &http.Client{}
 
 	// Point to dummy server for tests
-	os.Setenv("FB_API_BASE_URL", "http://localhost:9090")
-
 	return &instagram.Service{
 		Client:     client,
+		BaseURL:    DummyBaseURL,
 		IgUserID:   igUserID,
 		TokenStore: rt,
 	}
@@ -11,7 +11,7 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
-func InsertTokenRedis(client *redis.Client, accessToken string, expiry time.Time) error {
+func InsertTokenRedis(client redis.UniversalClient, accessToken string, expiry time.Time) error {
 	tok := token.Token{
 		AccessToken: accessToken,
 		ExpiresAt:   expiry,
@@ -0,0 +1,79 @@
+package integration
+
+import (
+	"testing"
+
+	"backend-service/internal/archive"
+	"backend-service/internal/instagram"
+	"backend-service/tests/helpers"
+)
+
+func TestMediaArchiveHistory(t *testing.T) {
+	db := helpers.SetupTestDB(t)
+	repo := archive.NewRepository(db, "default")
+
+	err := repo.Upsert([]instagram.Media{
+		{ID: "1", Caption: "first", Timestamp: "2026-01-01T10:00:00+0000"},
+		{ID: "2", Caption: "second", Timestamp: "2026-01-02T10:00:00+0000"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Caption edit is recorded, unchanged caption is not
+	err = repo.Upsert([]instagram.Media{
+		{ID: "1", Caption: "first (edited)", Timestamp: "2026-01-01T10:00:00+0000"},
+		{ID: "2", Caption: "second", Timestamp: "2026-01-02T10:00:00+0000"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := repo.GetCaptionHistory("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[1].Caption != "first (edited)" {
+		t.Fatalf("expected 2 caption versions, got %v", history)
+	}
+
+	if err := repo.MarkDeleted([]string{"2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	active, _, err := repo.LoadActive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(active) != 1 || active[0].ID != "1" {
+		t.Fatalf("expected only media 1 active, got %v", active)
+	}
+	if active[0].Timestamp != "2026-01-01T10:00:00+0000" {
+		t.Fatalf("timestamp did not round-trip, got %s", active[0].Timestamp)
+	}
+}
+
+func TestMediaArchiveIsScopedToAccount(t *testing.T) {
+	db := helpers.SetupTestDB(t)
+	clinic := archive.NewRepository(db, "clinic")
+	kids := archive.NewRepository(db, "kids")
+
+	// A collab post appears under both accounts with the same ID
+	if err := clinic.Upsert([]instagram.Media{{ID: "1", Caption: "collab"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := kids.Upsert([]instagram.Media{{ID: "1", Caption: "collab"}, {ID: "2"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := kids.MarkDeleted([]string{"1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	active, _, err := clinic.LoadActive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(active) != 1 || active[0].ID != "1" {
+		t.Fatalf("expected the clinic's copy of media 1 to stay active, got %v", active)
+	}
+}
@@ -1,6 +1,7 @@
 package integration
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
@@ -8,6 +9,7 @@ import (
 	"time"
 
 	"backend-service/internal/bootstrap"
+	"backend-service/internal/instagram"
 	"backend-service/internal/token"
 	"backend-service/tests/dummy"
 	"backend-service/tests/helpers"
@@ -25,10 +27,14 @@ func TestBootstrapInitTokenFromRedis(t *testing.T) {
 	rt := token.NewRuntime()
 
 	err := bootstrap.InitToken(
+		context.Background(),
 		rt,
-		redisClient,
+		token.Chain{
+			token.NewDiskSource("test_token.json"),
+			token.NewRedisSourceFor(redisClient, getTestTokenKey()),
+		},
 		&http.Client{},
-		"test_token.json",
+		instagram.App{BaseURL: helpers.DummyBaseURL, ID: "test_app_id", Secret: "test_app_secret"},
 	)
 
 	if err != nil {
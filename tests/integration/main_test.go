@@ -4,6 +4,8 @@ import (
 	"os"
 	"testing"
 
+	"backend-service/internal/token"
+
 	"github.com/joho/godotenv"
 )
 
@@ -16,6 +18,7 @@ func TestMain(m *testing.M) {
 	if os.Getenv("REDIS_TOKEN_KEY") == "" {
 		os.Setenv("REDIS_TOKEN_KEY", "test_instagram_token")
 	}
+	token.UseRedisKey(os.Getenv("REDIS_TOKEN_KEY"))
 
 	os.Exit(m.Run())
 }
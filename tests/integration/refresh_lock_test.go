@@ -0,0 +1,52 @@
+package integration
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"backend-service/internal/token"
+	"backend-service/tests/helpers"
+)
+
+func TestRefreshLockIsExclusiveAndFenced(t *testing.T) {
+	redisClient := helpers.SetupTestRedis(t)
+
+	first := token.NewRedisLockFor(redisClient, getTestTokenKey(), 200*time.Millisecond)
+	second := token.NewRedisLockFor(redisClient, getTestTokenKey(), time.Minute)
+
+	lease, err := first.Acquire()
+	if err != nil || lease == nil {
+		t.Fatalf("first instance should acquire the lease, got %v", err)
+	}
+
+	if other, err := second.Acquire(); err != nil || other != nil {
+		t.Fatalf("second instance should not acquire a held lease, got %v, %v", other, err)
+	}
+
+	// Let the first lease lapse so the second instance takes over
+	time.Sleep(300 * time.Millisecond)
+	takeover, err := second.Acquire()
+	if err != nil || takeover == nil {
+		t.Fatalf("second instance should acquire a lapsed lease, got %v", err)
+	}
+	defer takeover.Release()
+
+	fresh := token.Token{AccessToken: "FROM_SECOND", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := takeover.Save(fresh); err != nil {
+		t.Fatal(err)
+	}
+
+	stale := token.Token{AccessToken: "FROM_FIRST", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := lease.Save(stale); !errors.Is(err, token.ErrFenced) {
+		t.Fatalf("expected lapsed lease write to be fenced, got %v", err)
+	}
+
+	loaded, err := token.LoadFromRedis(redisClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.AccessToken != "FROM_SECOND" {
+		t.Fatalf("expected FROM_SECOND, got %s", loaded.AccessToken)
+	}
+}
@@ -1,8 +1,8 @@
 package integration
 
 import (
+	"context"
 	"net/http"
-	"os"
 	"testing"
 	"time"
 
@@ -14,11 +14,9 @@ import (
 )
 
 func TestTokenRefreshBeforeExpiryIntegration(t *testing.T) {
-	// Configure environment to use dummy server
-	os.Setenv("FB_API_BASE_URL", "http://localhost:9090")
-	os.Setenv("APP_ID", "test_app_id")
-	os.Setenv("APP_SECRET", "test_app_secret")
-	
+	// Use the dummy server for token exchange
+	app := instagram.App{BaseURL: helpers.DummyBaseURL, ID: "test_app_id", Secret: "test_app_secret"}
+
 	srv := dummy.StartDummyServer()
 	defer srv.Close()
 
@@ -31,7 +29,7 @@ func TestTokenRefreshBeforeExpiryIntegration(t *testing.T) {
 	}
 
 	rt := token.NewRuntime()
-	bootstrap.InitToken(rt, redisClient, &http.Client{}, "test_token.json")
+	bootstrap.InitToken(context.Background(), rt, token.Chain{token.NewRedisSourceFor(redisClient, getTestTokenKey())}, &http.Client{}, app)
 
 	// Verify bootstrap loaded the OLD_TOKEN
 	if rt.Get() != "OLD_TOKEN" {
@@ -39,8 +37,8 @@ func TestTokenRefreshBeforeExpiryIntegration(t *testing.T) {
 	}
 
 	refreshFn := func() {
-		if rt.IsValid() {
-			newToken, err := instagram.RefreshAccessToken(&http.Client{}, rt.Get())
+		if rt.NeedsRefresh(7 * 24 * time.Hour) {
+			newToken, err := instagram.RefreshAccessToken(context.Background(), &http.Client{}, app, rt.Get())
 			if err != nil {
 				t.Fatalf("refresh failed: %v", err)
 			}
@@ -59,3 +57,18 @@ func TestTokenRefreshBeforeExpiryIntegration(t *testing.T) {
 		t.Fatalf("token was not refreshed, expected REFRESHED_TOKEN, got %s", gotToken)
 	}
 }
+
+func TestInstagramLoginRefreshIntegration(t *testing.T) {
+	srv := dummy.StartDummyServer()
+	defer srv.Close()
+
+	provider := instagram.InstagramLogin{BaseURL: helpers.DummyBaseURL}
+
+	newToken, err := provider.Refresh(context.Background(), &http.Client{}, "OLD_TOKEN")
+	if err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if newToken.AccessToken != "REFRESHED_TOKEN" {
+		t.Fatalf("expected REFRESHED_TOKEN, got %s", newToken.AccessToken)
+	}
+}